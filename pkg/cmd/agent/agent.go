@@ -16,6 +16,7 @@
 package agent
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"time"
@@ -24,26 +25,64 @@ import (
 	"github.com/diambra/cli/pkg/diambra/client"
 	"github.com/diambra/cli/pkg/git"
 	"github.com/diambra/cli/pkg/log"
+	"github.com/distribution/reference"
 	"github.com/go-kit/log/level"
+	"github.com/opencontainers/go-digest"
 
 	"github.com/spf13/cobra"
 )
 
-func NewCommand(logger *log.Logger) *cobra.Command {
+func NewCommand(logger *log.Logger, runtime *container.Runtime) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "agent",
 		Short: "Agent commands",
 		Long:  `These are the agent related commands`,
 	}
 	cmd.AddCommand(NewInitCmd(logger))
-	cmd.AddCommand(NewSubmitCmd(logger))
-	cmd.AddCommand(NewTestCmd(logger))
-	cmd.AddCommand(NewBuildCmd(logger))
-	cmd.AddCommand(NewBuildAndPushCmd(logger))
+	cmd.AddCommand(NewSubmitCmd(logger, runtime))
+	cmd.AddCommand(NewTestCmd(logger, runtime))
+	cmd.AddCommand(NewBuildCmd(logger, runtime))
+	cmd.AddCommand(NewBuildAndPushCmd(logger, runtime))
 	return cmd
 }
 
-func buildAndPush(logger *log.Logger, client *client.Client, context, name, version string) (string, error) {
+// login logs the runner in to the DIAMBRA registry and returns the repository URL.
+func login(runner container.Runner, client *client.Client) (*url.URL, error) {
+	credentials, err := client.Credentials()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials: %w", err)
+	}
+	repositoryURL, err := url.Parse(credentials.Repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+	runner.Login(credentials.Username, credentials.Password, repositoryURL.Host)
+	return repositoryURL, nil
+}
+
+// pinDigest resolves the tag to its digest in the registry and returns the
+// image reference pinned to it as repo@sha256:..., along with the digest.
+func pinDigest(ctx context.Context, runner container.Runner, tag string) (string, string, error) {
+	named, err := reference.ParseNormalizedNamed(tag)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid image reference %s: %w", tag, err)
+	}
+	if canonical, ok := named.(reference.Canonical); ok {
+		// Already pinned
+		return tag, canonical.Digest().String(), nil
+	}
+	dgst, err := runner.Digest(ctx, tag)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve digest of %s: %w", tag, err)
+	}
+	canonical, err := reference.WithDigest(reference.TrimNamed(named), digest.Digest(dgst))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid digest %s for %s: %w", dgst, tag, err)
+	}
+	return reference.FamiliarString(canonical), dgst, nil
+}
+
+func buildAndPush(ctx context.Context, logger *log.Logger, runner container.Runner, client *client.Client, context, name, version string, buildOptions container.BuildOptions) (string, error) {
 	var err error
 	if name == "" {
 		name, err = container.TagFromDir(context)
@@ -60,36 +99,24 @@ func buildAndPush(logger *log.Logger, client *client.Client, context, name, vers
 		}
 	}
 
-	credentials, err := client.Credentials()
-	if err != nil {
-		return "", fmt.Errorf("failed to get credentials: %w", err)
-	}
-
 	level.Info(logger).Log("msg", "Building agent", "name", name, "version", version)
-	runner, err := container.NewDockerRunner(logger, false)
+	repositoryURL, err := login(runner, client)
 	if err != nil {
-		return "", fmt.Errorf("failed to create docker runner: %w", err)
+		return "", err
 	}
 
-	repositoryURL, err := url.Parse(credentials.Repository)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse repository URL: %w", err)
-	}
-
-	runner.Login(credentials.Username, credentials.Password, repositoryURL.Host)
-
 	tag := fmt.Sprintf("%s%s:%s-%s", repositoryURL.Host, repositoryURL.Path, name, version)
 
-	if exists, err := runner.TagExists(tag); err != nil {
+	if exists, err := runner.TagExists(ctx, tag); err != nil {
 		return "", fmt.Errorf("failed to check if tag exists: %w", err)
 	} else if exists {
 		return "", fmt.Errorf("tag %s already exists, use --name or --version to specify unused tag", tag)
 	}
 
-	if err := runner.Build(context, tag); err != nil {
+	if err := runner.Build(ctx, context, tag, buildOptions); err != nil {
 		return "", fmt.Errorf("failed to build agent: %w", err)
 	}
-	if err := runner.Push(tag); err != nil {
+	if err := runner.Push(ctx, tag); err != nil {
 		return "", fmt.Errorf("failed to push agent: %w", err)
 	}
 	return tag, nil
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/diambra/cli/pkg/container/containertest"
+	"github.com/diambra/cli/pkg/diambra/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestPinDigest(t *testing.T) {
+	const pinnedDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	for _, tc := range []struct {
+		name     string
+		tag      string
+		expected string
+		digest   string
+		err      bool
+	}{
+		{
+			name:     "registry tag",
+			tag:      "registry.diambra.ai/user/agent:v1",
+			expected: "registry.diambra.ai/user/agent@" + containertest.Digest("registry.diambra.ai/user/agent:v1"),
+			digest:   containertest.Digest("registry.diambra.ai/user/agent:v1"),
+		},
+		{
+			name:     "docker hub tag",
+			tag:      "user/agent:v1",
+			expected: "user/agent@" + containertest.Digest("user/agent:v1"),
+			digest:   containertest.Digest("user/agent:v1"),
+		},
+		{
+			name:     "already pinned",
+			tag:      "user/agent@" + pinnedDigest,
+			expected: "user/agent@" + pinnedDigest,
+			digest:   pinnedDigest,
+		},
+		{
+			name: "unknown tag",
+			tag:  "user/agent:unknown",
+			err:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			runner := containertest.NewRunner()
+			runner.Tags["registry.diambra.ai/user/agent:v1"] = true
+			runner.Tags["user/agent:v1"] = true
+
+			pinned, digest, err := pinDigest(context.Background(), runner, tc.tag)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, pinned)
+			assert.Equal(t, tc.digest, digest)
+		})
+	}
+}
+
+func TestSubmissionDump(t *testing.T) {
+	b, err := yaml.Marshal(&submissionDump{
+		Submission: client.Submission{Manifest: client.Manifest{Image: "user/agent@sha256:abc"}},
+		Image:      submittedImage{Tag: "user/agent:v1", Digest: "sha256:abc"},
+	})
+	require.NoError(t, err)
+	dump := map[string]map[string]interface{}{}
+	require.NoError(t, yaml.Unmarshal(b, &dump))
+	assert.Equal(t, "user/agent@sha256:abc", dump["manifest"]["image"])
+	assert.Equal(t, "user/agent:v1", dump["image"]["tag"])
+	assert.Equal(t, "sha256:abc", dump["image"]["digest"])
+}
@@ -24,8 +24,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func NewBuildCmd(logger *log.Logger) *cobra.Command {
-	tag := ""
+func NewBuildCmd(logger *log.Logger, runtime *container.Runtime) *cobra.Command {
+	var (
+		tag          = ""
+		buildOptions = container.BuildOptions{}
+	)
 	cmd := &cobra.Command{
 		Use:   "build [path/to/agent]",
 		Short: "Build a container image for submission",
@@ -35,9 +38,9 @@ func NewBuildCmd(logger *log.Logger) *cobra.Command {
 				args = []string{"."}
 			}
 
-			runner, err := container.NewDockerRunner(logger, false)
+			runner, err := container.NewRunner(logger, *runtime, false)
 			if err != nil {
-				level.Error(logger).Log("msg", "failed to create docker runner", "err", err)
+				level.Error(logger).Log("msg", "failed to create container runner", "err", err)
 				os.Exit(1)
 			}
 
@@ -50,7 +53,7 @@ func NewBuildCmd(logger *log.Logger) *cobra.Command {
 				}
 			}
 
-			if err := runner.Build(args[0], tag); err != nil {
+			if err := runner.Build(cmd.Context(), args[0], tag, buildOptions); err != nil {
 				level.Error(logger).Log("msg", "failed to build agent", "err", err)
 				os.Exit(1)
 			}
@@ -58,6 +61,7 @@ func NewBuildCmd(logger *log.Logger) *cobra.Command {
 		Args: cobra.MaximumNArgs(1),
 	}
 	cmd.Flags().StringVarP(&tag, "tag", "t", tag, "Tag for the image")
+	buildOptions.AddFlags(cmd.Flags())
 
 	return cmd
 }
@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/diambra/cli/pkg/container"
 	"github.com/diambra/cli/pkg/diambra/client"
 	"github.com/diambra/cli/pkg/log"
 	"github.com/go-kit/log/level"
@@ -28,11 +29,12 @@ import (
 
 const defaultCredPath = "~/.diambra/credentials"
 
-func NewBuildAndPushCmd(logger *log.Logger) *cobra.Command {
+func NewBuildAndPushCmd(logger *log.Logger, runtime *container.Runtime) *cobra.Command {
 	var (
-		name     = ""
-		version  = ""
-		credPath = defaultCredPath
+		name         = ""
+		version      = ""
+		credPath     = defaultCredPath
+		buildOptions = container.BuildOptions{}
 	)
 
 	cmd := &cobra.Command{
@@ -59,18 +61,30 @@ func NewBuildAndPushCmd(logger *log.Logger) *cobra.Command {
 				os.Exit(1)
 			}
 
-			tag, err := buildAndPush(logger, cl, args[0], name, version)
+			runner, err := container.NewRunner(logger, *runtime, false)
+			if err != nil {
+				level.Error(logger).Log("msg", "failed to create container runner", "err", err)
+				os.Exit(1)
+			}
+
+			tag, err := buildAndPush(cmd.Context(), logger, runner, cl, args[0], name, version, buildOptions)
 			if err != nil {
 				level.Error(logger).Log("msg", "failed to build and push agent", "err", err)
 				os.Exit(1)
 			}
-			level.Info(logger).Log("msg", fmt.Sprintf("Agent built and pushed: %s", tag), "tag", tag)
+			pinned, _, err := pinDigest(cmd.Context(), runner, tag)
+			if err != nil {
+				level.Error(logger).Log("msg", "failed to pin agent image", "err", err)
+				os.Exit(1)
+			}
+			level.Info(logger).Log("msg", fmt.Sprintf("Agent built and pushed: %s", pinned), "tag", tag, "image", pinned)
 		},
 		Args: cobra.MaximumNArgs(1),
 	}
 	cmd.Flags().StringVar(&credPath, "path.credentials", defaultCredPath, "Path to credentials file")
 	cmd.Flags().StringVar(&name, "name", name, "Name of the agent image (only used when giving a directory)")
 	cmd.Flags().StringVar(&version, "version", version, "Version of the agent image (only used when giving a directory)")
+	buildOptions.AddFlags(cmd.Flags())
 
 	return cmd
 }
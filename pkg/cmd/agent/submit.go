@@ -16,10 +16,12 @@
 package agent
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 
+	"github.com/diambra/cli/pkg/container"
 	"github.com/diambra/cli/pkg/diambra"
 	"github.com/diambra/cli/pkg/diambra/client"
 	"github.com/diambra/cli/pkg/log"
@@ -28,12 +30,13 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
-func NewSubmitCmd(logger *log.Logger) *cobra.Command {
+func NewSubmitCmd(logger *log.Logger, runtime *container.Runtime) *cobra.Command {
 	var (
 		dump             = false
 		submissionConfig = diambra.SubmissionConfig{}
 		name             = ""
 		version          = ""
+		buildOptions     = container.BuildOptions{}
 	)
 
 	c, err := diambra.NewConfig(logger)
@@ -57,34 +60,30 @@ func NewSubmitCmd(logger *log.Logger) *cobra.Command {
 				level.Error(logger).Log("msg", "failed to configure manifest", "err", err.Error())
 				os.Exit(1)
 			}
-			if dump {
-				b, err := yaml.Marshal(submission)
-				if err != nil {
-					level.Error(logger).Log("msg", "failed to marshal manifest", "err", err.Error())
-					os.Exit(1)
-				}
-				fmt.Println(string(b))
-				return
-			}
-
 			cl, err := client.NewClient(logger, c.CredPath)
 			if err != nil {
 				level.Error(logger).Log("msg", "failed to create client", "err", err.Error())
 				os.Exit(1)
 			}
-			// If submission.Image is a directory, we build and push it, then update the name to the resulting image
-			if stat, err := os.Stat(submission.Manifest.Image); err == nil && stat.IsDir() {
-				context := submission.Manifest.Image
-				level.Info(logger).Log("msg", "Building and pushing image", "context", context)
-				tag, err := buildAndPush(logger, cl, context, name, version)
+			runner, err := container.NewRunner(logger, *runtime, false)
+			if err != nil {
+				level.Error(logger).Log("msg", "failed to create container runner", "err", err.Error())
+				os.Exit(1)
+			}
+			image, err := pinImage(cmd.Context(), logger, runner, cl, submission, name, version, buildOptions)
+			if err != nil {
+				level.Error(logger).Log("msg", "failed to prepare agent image", "err", err.Error())
+				os.Exit(1)
+			}
+
+			if dump {
+				b, err := yaml.Marshal(&submissionDump{Submission: *submission, Image: image})
 				if err != nil {
-					level.Error(logger).Log("msg", "failed to build and push agent", "err", err.Error())
+					level.Error(logger).Log("msg", "failed to marshal manifest", "err", err.Error())
 					os.Exit(1)
 				}
-
-				submission.Manifest.Image = tag
-			} else {
-				level.Warn(logger).Log("msg", "Using existing images or submission manifest is not recommended and might get deprecated in the future")
+				fmt.Println(string(b))
+				return
 			}
 
 			id, err := cl.Submit(submission)
@@ -98,9 +97,48 @@ func NewSubmitCmd(logger *log.Logger) *cobra.Command {
 	submissionConfig.AddFlags(cmd.Flags())
 	// FIXME: Split this out of EnvConfig
 	cmd.Flags().StringVar(&c.CredPath, "path.credentials", filepath.Join(c.Home, ".diambra/credentials"), "Path to credentials file")
-	cmd.Flags().BoolVar(&dump, "dump", false, "Dump the manifest to stdout instead of submitting")
+	cmd.Flags().BoolVar(&dump, "dump", false, "Dump the manifest to stdout instead of submitting. Directories still get built and pushed")
 	cmd.Flags().SetInterspersed(false)
 	cmd.Flags().StringVar(&name, "name", name, "Name of the agent image (only used when giving a directory)")
 	cmd.Flags().StringVar(&version, "version", version, "Version of the agent image (only used when giving a directory)")
+	buildOptions.AddFlags(cmd.Flags())
 	return cmd
 }
+
+// submittedImage records which tag the submitted image got pinned from.
+type submittedImage struct {
+	Tag    string `yaml:"tag"`
+	Digest string `yaml:"digest"`
+}
+
+type submissionDump struct {
+	client.Submission `yaml:",inline"`
+	Image             submittedImage `yaml:"image"`
+}
+
+// pinImage builds and pushes the image if the submission refers to a
+// directory, then pins the submitted image to its digest in the registry.
+func pinImage(ctx context.Context, logger *log.Logger, runner container.Runner, cl *client.Client, submission *client.Submission, name, version string, buildOptions container.BuildOptions) (submittedImage, error) {
+	tag := submission.Manifest.Image
+	if stat, err := os.Stat(tag); err == nil && stat.IsDir() {
+		// If submission.Image is a directory, we build and push it, then update the name to the resulting image
+		level.Info(logger).Log("msg", "Building and pushing image", "context", tag)
+		tag, err = buildAndPush(ctx, logger, runner, cl, tag, name, version, buildOptions)
+		if err != nil {
+			return submittedImage{}, fmt.Errorf("failed to build and push agent: %w", err)
+		}
+	} else {
+		level.Warn(logger).Log("msg", "Using existing images or submission manifest is not recommended and might get deprecated in the future")
+		if _, err := login(runner, cl); err != nil {
+			return submittedImage{}, err
+		}
+	}
+
+	pinned, digest, err := pinDigest(ctx, runner, tag)
+	if err != nil {
+		return submittedImage{}, err
+	}
+	level.Info(logger).Log("msg", "Pinned agent image to digest", "tag", tag, "image", pinned)
+	submission.Manifest.Image = pinned
+	return submittedImage{Tag: tag, Digest: digest}, nil
+}
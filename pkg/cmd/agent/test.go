@@ -1,10 +1,10 @@
 package agent
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"os/signal"
 	"syscall"
 
@@ -22,7 +22,7 @@ const (
 	EvaluationUser = "1000" // User(ID) that the agent is started as in production
 )
 
-func NewTestCmd(logger *log.Logger) *cobra.Command {
+func NewTestCmd(logger *log.Logger, runtime *container.Runtime) *cobra.Command {
 	submissionConfig := diambra.SubmissionConfig{}
 	c, err := diambra.NewConfig(logger)
 	if err != nil {
@@ -35,66 +35,74 @@ func NewTestCmd(logger *log.Logger) *cobra.Command {
 		Use:   "test [flags] {--submission.manifest submission-manifest.yaml | docker-image} [args/command(s) ...]",
 		Short: "Run an agent from image or manifest similar to how it would be evaluated",
 		Long: `This takes a docker image or submission manifest and runs it in the same way as it would be run when submitted
-		to DIAMBRA. This is useful for testing your agent before submitting it. Optionally, you can pass in commands to run instead of the configured entrypoint.`,
+		to DIAMBRA. This is useful for testing your agent before submitting it. Optionally, you can pass in commands to run instead of the configured entrypoint.
+		Use --agent.memory and --agent.cpus to run the agent with the resource limits of the evaluation.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			submission, err := submissionConfig.Submission(c, args)
 			if err != nil {
 				level.Error(logger).Log("msg", "failed to configure manifest", "err", err.Error())
 				os.Exit(1)
 			}
-			if err := TestFn(logger, c, submission); err != nil {
+			status, err := TestFn(logger, *runtime, c, submission)
+			if err != nil {
 				level.Error(logger).Log("msg", "failed to run agent", "err", err.Error(), "manifest", fmt.Sprintf("%#v", submission.Manifest))
 				os.Exit(1)
 			}
+			if status != 0 {
+				level.Error(logger).Log("msg", "agent container failed with status", "status", status)
+				os.Exit(status)
+			}
 		},
 	}
 	c.AddFlags(cmd.Flags())
+	c.AddAttachSessionFlag(cmd.Flags())
 	submissionConfig.AddFlags(cmd.Flags())
 	cmd.Flags().SetInterspersed(false)
 	return cmd
 }
 
-func TestFn(logger *log.Logger, c *diambra.EnvConfig, submission *client.Submission) error {
+// TestFn runs the submission's agent against DIAMBRA arena and returns the agent's exit status.
+func TestFn(logger *log.Logger, runtime container.Runtime, c *diambra.EnvConfig, submission *client.Submission) (int, error) {
 	level.Debug(logger).Log("manifest", fmt.Sprintf("%#v", submission.Manifest), "config", fmt.Sprintf("%#v", c))
 
-	runner, err := container.NewDockerRunner(logger, c.AutoRemove)
+	runner, err := container.NewRunner(logger, runtime, c.AutoRemove)
 	if err != nil {
-		return err
+		return 1, err
 	}
-	console := console.Current()
+	return testAgent(logger, runner, console.Current(), c, submission)
+}
+
+func testAgent(logger *log.Logger, runner container.Runner, console console.Console, c *diambra.EnvConfig, submission *client.Submission) (int, error) {
 	d, err := diambra.NewDiambra(logger, console, runner, c)
 	if err != nil {
-		return fmt.Errorf("couldn't create DIAMBRA Env: %w", err)
+		return 1, fmt.Errorf("couldn't create DIAMBRA Env: %w", err)
 	}
 	defer func() {
-		if err := d.Cleanup(); err != nil {
+		if err := d.Cleanup(context.Background()); err != nil {
 			level.Error(logger).Log("msg", "Couldn't cleanup DIAMBRA Env", "err", err.Error())
 		}
 	}()
-	var (
-		signalCh = make(chan os.Signal, 1)
-		ex       *exec.Cmd
-	)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		s := <-signalCh
 		level.Info(logger).Log("msg", "Received signal, terminating", "signal", s)
-		if err := console.Reset(); err != nil {
-			level.Error(logger).Log("msg", "Couldn't reset console", "err", err.Error())
-		}
-		if err := d.Cleanup(); err != nil {
-			level.Error(logger).Log("msg", "cleanup failed", "err", err.Error())
-		}
-		if ex != nil {
-			if err := ex.Process.Kill(); err != nil {
-				level.Error(logger).Log("msg", "Couldn't kill process", "err", err.Error())
+		if console != nil {
+			if err := console.Reset(); err != nil {
+				level.Error(logger).Log("msg", "Couldn't reset console", "err", err.Error())
 			}
 		}
-		os.Exit(1)
+		cancel(fmt.Errorf("received signal %s", s))
 	}()
 	level.Debug(logger).Log("msg", "starting DIAMBRA env")
-	if err := d.Start(); err != nil {
-		return fmt.Errorf("could't start DIAMBRA Env: %w", err)
+	if err := d.Start(ctx); err != nil {
+		if ctx.Err() != nil {
+			return 1, context.Cause(ctx)
+		}
+		return 1, fmt.Errorf("could't start DIAMBRA Env: %w", err)
 	}
 
 	env := make([]string, len(submission.Manifest.Env))
@@ -104,10 +112,14 @@ func TestFn(logger *log.Logger, c *diambra.EnvConfig, submission *client.Submiss
 		i++
 	}
 	ctnr := &container.Container{
+		Name:  "agent",
 		Image: submission.Manifest.Image,
 		Env:   env,
 		User:  EvaluationUser,
 	}
+	if err := c.AgentResources.Apply(ctnr); err != nil {
+		return 1, err
+	}
 	if submission.Manifest.Command != nil {
 		ctnr.Command = submission.Manifest.Command
 	}
@@ -124,7 +136,7 @@ func TestFn(logger *log.Logger, c *diambra.EnvConfig, submission *client.Submiss
 		level.Info(logger).Log("msg", "running init container to fetch sources")
 		tmpDir, err := os.MkdirTemp("", "diambra-init")
 		if err != nil {
-			return fmt.Errorf("couldn't create temp dir: %w", err)
+			return 1, fmt.Errorf("couldn't create temp dir: %w", err)
 		}
 		defer os.RemoveAll(tmpDir)
 		sourcesBindMount := container.NewBindMount(tmpDir, "/sources")
@@ -133,14 +145,15 @@ func TestFn(logger *log.Logger, c *diambra.EnvConfig, submission *client.Submiss
 
 		sourcesJSON, err := json.Marshal(submission.Manifest.Sources)
 		if err != nil {
-			return fmt.Errorf("failed to marshal sources: %w", err)
+			return 1, fmt.Errorf("failed to marshal sources: %w", err)
 		}
 		secretsJSON, err := json.Marshal(submission.Secrets)
 		if err != nil {
-			return fmt.Errorf("failed to marshal secrets: %w", err)
+			return 1, fmt.Errorf("failed to marshal secrets: %w", err)
 		}
 
 		initContainer := &container.Container{
+			Name:  "init",
 			Image: c.InitImage,
 			BindMounts: []*container.BindMount{
 				container.NewBindMount(TLSCertPath, TLSCertPath),
@@ -153,21 +166,23 @@ func TestFn(logger *log.Logger, c *diambra.EnvConfig, submission *client.Submiss
 			WorkingDir: "/sources",
 			User:       EvaluationUser,
 		}
-		status, err := d.RunAgentContainer(initContainer)
+		status, err := d.RunAgentContainer(ctx, initContainer)
 		if err != nil {
-			return fmt.Errorf("failed to run init container: %w", err)
+			if ctx.Err() != nil {
+				return 1, context.Cause(ctx)
+			}
+			return 1, fmt.Errorf("failed to run init container: %w", err)
 		}
 		if status != 0 {
-			return fmt.Errorf("init container failed with status %d", status)
+			return 1, fmt.Errorf("init container failed with status %d", status)
 		}
 	}
-	status, err := d.RunAgentContainer(ctnr)
+	status, err := d.RunAgentContainer(ctx, ctnr)
 	if err != nil {
-		return fmt.Errorf("failed to run agent container: %w", err)
-	}
-	if status != 0 {
-		level.Error(logger).Log("msg", "agent container failed with status", "status", status)
-		os.Exit(status)
+		if ctx.Err() != nil {
+			return 1, context.Cause(ctx)
+		}
+		return 1, fmt.Errorf("failed to run agent container: %w", err)
 	}
-	return nil
+	return status, nil
 }
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/diambra/cli/pkg/cmd/cmdtest"
+	"github.com/diambra/cli/pkg/container/containertest"
+	"github.com/diambra/cli/pkg/diambra"
+	"github.com/diambra/cli/pkg/diambra/client"
+	"github.com/diambra/cli/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestAgent(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		manifest   client.Manifest
+		behaviors  map[string]containertest.Behavior
+		failStep   containertest.Step
+		status     int
+		err        bool
+		containers []string // images started
+	}{
+		{
+			name:       "success",
+			manifest:   client.Manifest{Image: "agent:test", Args: []string{"--gameId", "doapp"}},
+			behaviors:  map[string]containertest.Behavior{"agent:test": {Exit: true}},
+			containers: []string{"diambra/engine:test", "agent:test"},
+		},
+		{
+			name:       "agent fails",
+			manifest:   client.Manifest{Image: "agent:test"},
+			behaviors:  map[string]containertest.Behavior{"agent:test": {Exit: true, ExitCode: 2}},
+			status:     2,
+			containers: []string{"diambra/engine:test", "agent:test"},
+		},
+		{
+			name:     "with sources",
+			manifest: client.Manifest{Image: "agent:test", Sources: map[string]string{"model.zip": "https://example.com/model.zip"}},
+			behaviors: map[string]containertest.Behavior{
+				"init:test":  {Exit: true},
+				"agent:test": {Exit: true},
+			},
+			containers: []string{"diambra/engine:test", "init:test", "agent:test"},
+		},
+		{
+			name:     "init fails",
+			manifest: client.Manifest{Image: "agent:test", Sources: map[string]string{"model.zip": "https://example.com/model.zip"}},
+			behaviors: map[string]containertest.Behavior{
+				"init:test": {Exit: true, ExitCode: 1},
+			},
+			status:     1,
+			err:        true,
+			containers: []string{"diambra/engine:test", "init:test"},
+		},
+		{
+			name:       "attach fails",
+			manifest:   client.Manifest{Image: "agent:test"},
+			failStep:   containertest.StepAttach,
+			status:     1,
+			err:        true,
+			containers: []string{"diambra/engine:test", "agent:test"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := log.New()
+			c := cmdtest.NewConfig(t, logger)
+			c.InitImage = "init:test"
+			c.AgentResources = diambra.Resources{Memory: "4g", CPUs: 2}
+			runner := containertest.NewRunner()
+			runner.Behaviors = tc.behaviors
+			if tc.failStep != "" {
+				runner.FailAt(tc.failStep, 0, errors.New("scripted failure"))
+			}
+
+			status, err := testAgent(logger, runner, nil, c, &client.Submission{Manifest: tc.manifest})
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.status, status)
+
+			images := []string{}
+			for _, ctnr := range runner.Containers() {
+				images = append(images, ctnr.Image)
+				if ctnr.Image != "diambra/engine:test" {
+					assert.Equal(t, EvaluationUser, ctnr.User)
+				}
+				if ctnr.Image == "agent:test" {
+					assert.Equal(t, int64(4<<30), ctnr.MemoryLimitBytes)
+					assert.Equal(t, float64(2), ctnr.CPULimitCores)
+				}
+			}
+			assert.Equal(t, tc.containers, images)
+			assert.Empty(t, runner.Running())
+		})
+	}
+}
@@ -18,20 +18,23 @@ package arena
 import (
 	"os"
 
+	"github.com/diambra/cli/pkg/container"
 	"github.com/diambra/cli/pkg/log"
 	"github.com/go-kit/log/level"
 	"github.com/spf13/cobra"
 )
 
-func NewCommand(logger *log.Logger) *cobra.Command {
+func NewCommand(logger *log.Logger, runtime *container.Runtime) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "arena",
 		Short: "Arena commands",
 		Long:  `These are the arena related commands`,
 	}
-	cmd.AddCommand(NewUpCmd(logger))
-	cmd.AddCommand(NewDownCmd(logger))
-	cmd.AddCommand(StatusCmd)
+	cmd.AddCommand(NewUpCmd(logger, runtime))
+	cmd.AddCommand(NewDownCmd(logger, runtime))
+	cmd.AddCommand(NewStatusCmd(logger, runtime))
+	cmd.AddCommand(NewLogsCmd(logger, runtime))
+	cmd.AddCommand(NewTopCmd(logger, runtime))
 	romCmds, err := NewRomCmds(logger)
 	if err != nil {
 		level.Error(logger).Log("msg", "failed to create rom commands", "err", err.Error())
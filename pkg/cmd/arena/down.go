@@ -16,29 +16,52 @@
 package arena
 
 import (
+	"context"
 	"os"
 
 	"github.com/diambra/cli/pkg/container"
+	"github.com/diambra/cli/pkg/diambra"
 	"github.com/diambra/cli/pkg/log"
 	"github.com/go-kit/log/level"
 	"github.com/spf13/cobra"
 )
 
-func NewDownCmd(logger *log.Logger) *cobra.Command {
-	return &cobra.Command{
+func NewDownCmd(logger *log.Logger, runtime *container.Runtime) *cobra.Command {
+	session := ""
+	cmd := &cobra.Command{
 		Use:   "down",
 		Short: "Stop DIAMBRA Arena",
-		Long:  `This stops a DIAMBRA Arena running in the background.`,
-		Run: func(_ *cobra.Command, _ []string) {
-			runner, err := container.NewDockerRunner(logger, true)
+		Long: `This stops a DIAMBRA Arena running in the background.
+
+Without --session, the containers of all sessions are stopped.
+Records of sessions that aren't running anymore get removed.`,
+		Run: func(cmd *cobra.Command, _ []string) {
+			runner, err := container.NewRunner(logger, *runtime, true)
 			if err != nil {
 				level.Error(logger).Log("msg", "msg", "failed to create runner", "err", err.Error())
 				os.Exit(1)
 			}
-			if err := runner.StopAll(); err != nil {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				level.Error(logger).Log("msg", "couldn't get homedir", "err", err.Error())
+				os.Exit(1)
+			}
+			if err := down(cmd.Context(), logger, runner, diambra.SessionsDir(home), session); err != nil {
 				level.Error(logger).Log("msg", "failed to stop all containers", "err", err.Error())
 				os.Exit(1)
 			}
 		},
 	}
+	cmd.Flags().StringVar(&session, "session", session, "Only stop the containers of this session")
+	return cmd
+}
+
+func down(ctx context.Context, logger *log.Logger, runner container.Runner, sessionsDir, session string) error {
+	if err := runner.StopAll(ctx, session); err != nil {
+		return err
+	}
+	if err := diambra.PruneSessionStates(ctx, logger, runner, sessionsDir); err != nil {
+		level.Warn(logger).Log("msg", "couldn't remove records of stopped sessions", "err", err.Error())
+	}
+	return nil
 }
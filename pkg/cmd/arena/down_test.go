@@ -0,0 +1,62 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package arena
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/diambra/cli/pkg/cmd/cmdtest"
+	"github.com/diambra/cli/pkg/container/containertest"
+	"github.com/diambra/cli/pkg/diambra"
+	"github.com/diambra/cli/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDown(t *testing.T) {
+	logger := log.New()
+	c := cmdtest.NewConfig(t, logger)
+	runner := containertest.NewRunner()
+	for _, session := range []string{"foo", "bar", "baz"} {
+		c.Session = session
+		require.NoError(t, up(context.Background(), logger, runner, nil, c, &bytes.Buffer{}, "text"))
+	}
+	sessions := func() []string {
+		states, err := diambra.ListSessionStates(c.SessionsDir)
+		require.NoError(t, err)
+		names := []string{}
+		for _, s := range states {
+			names = append(names, s.Session)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"bar", "baz", "foo"}, sessions())
+
+	// Stale records are removed by status.
+	require.NoError(t, runner.StopAll(context.Background(), "baz"))
+	require.NoError(t, status(context.Background(), logger, runner, &bytes.Buffer{}, c.SessionsDir, "", "json"))
+	assert.Equal(t, []string{"bar", "foo"}, sessions())
+
+	require.NoError(t, down(context.Background(), logger, runner, c.SessionsDir, "foo"))
+	assert.Equal(t, []string{"bar"}, sessions())
+	assert.Len(t, runner.Running(), 1)
+
+	require.NoError(t, down(context.Background(), logger, runner, c.SessionsDir, ""))
+	assert.Empty(t, sessions())
+	assert.Empty(t, runner.Running())
+}
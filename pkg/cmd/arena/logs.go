@@ -0,0 +1,182 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package arena
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/diambra/cli/pkg/container"
+	"github.com/diambra/cli/pkg/log"
+	"github.com/go-kit/log/level"
+	"github.com/spf13/cobra"
+)
+
+func NewLogsCmd(logger *log.Logger, runtime *container.Runtime) *cobra.Command {
+	var (
+		session = ""
+		env     = -1
+		opts    = container.LogsOptions{}
+	)
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Show the output of DIAMBRA arena environments",
+		Long: `This shows the output of the environments of an arena started with arena up.
+
+Without --session, the only running session is used. With multiple
+environments, each line is prefixed with the name of its environment.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			runner, err := container.NewRunner(logger, *runtime, true)
+			if err != nil {
+				level.Error(logger).Log("msg", "failed to create runner", "err", err.Error())
+				os.Exit(1)
+			}
+			if err := logs(cmd.Context(), runner, os.Stdout, session, env, opts); err != nil {
+				level.Error(logger).Log("msg", "failed to get logs", "err", err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&session, "session", session, "Session to show the logs of")
+	cmd.Flags().IntVar(&env, "env", env, "Only show the logs of this environment, -1 for all")
+	cmd.Flags().BoolVarP(&opts.Follow, "follow", "f", false, "Follow the output until the environments exit")
+	cmd.Flags().StringVar(&opts.Since, "since", "", "Only show output since this timestamp (e.g. 2025-01-02T15:04:05Z) or duration ago (e.g. 10m)")
+	return cmd
+}
+
+type logEnv struct {
+	index int
+	id    string
+}
+
+func logs(ctx context.Context, runner container.Runner, out io.Writer, session string, env int, opts container.LogsOptions) error {
+	infos, err := runner.List(ctx, session)
+	if err != nil {
+		return err
+	}
+	sessions := map[string]bool{}
+	envs := []logEnv{}
+	for _, info := range infos {
+		index, err := strconv.Atoi(info.Labels[container.LabelEnv])
+		if err != nil {
+			continue
+		}
+		sessions[info.Labels[container.LabelSession]] = true
+		if env >= 0 && index != env {
+			continue
+		}
+		envs = append(envs, logEnv{index, info.ID})
+	}
+	if len(sessions) > 1 {
+		names := make([]string, 0, len(sessions))
+		for name := range sessions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("multiple sessions found (%s), select one with --session", strings.Join(names, ", "))
+	}
+	if len(envs) == 0 {
+		if env >= 0 {
+			return fmt.Errorf("env %d not found", env)
+		}
+		return fmt.Errorf("no environments found")
+	}
+	sort.Slice(envs, func(i, j int) bool { return envs[i].index < envs[j].index })
+
+	if len(envs) == 1 {
+		return runner.Logs(ctx, envs[0].id, opts, out)
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs = make([]error, len(envs))
+	)
+	for i, e := range envs {
+		w := &prefixWriter{mu: &mu, out: out, prefix: fmt.Sprintf("arena-%d | ", e.index)}
+		run := func(i int, e logEnv) {
+			errs[i] = runner.Logs(ctx, e.id, opts, w)
+			w.Flush()
+		}
+		if !opts.Follow {
+			// Without following, show the logs of one env after the other.
+			run(i, e)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, e logEnv) {
+			defer wg.Done()
+			run(i, e)
+		}(i, e)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("couldn't get logs of env %d: %w", envs[i].index, err)
+		}
+	}
+	return nil
+}
+
+// prefixWriter writes complete lines with a prefix to out. Writers sharing mu
+// can write to the same out concurrently without mixing their lines.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Flush writes a remaining incomplete line.
+func (w *prefixWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.writeLine(append(w.buf, '\n'))
+	w.buf = nil
+	return err
+}
+
+func (w *prefixWriter) writeLine(line []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := io.WriteString(w.out, w.prefix); err != nil {
+		return err
+	}
+	_, err := w.out.Write(line)
+	return err
+}
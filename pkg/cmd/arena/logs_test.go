@@ -0,0 +1,101 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package arena
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/diambra/cli/pkg/cmd/cmdtest"
+	"github.com/diambra/cli/pkg/container"
+	"github.com/diambra/cli/pkg/container/containertest"
+	"github.com/diambra/cli/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogs(t *testing.T) {
+	logger := log.New()
+	c := cmdtest.NewConfig(t, logger)
+	c.Scale = 2
+	c.Session = "foo"
+	runner := containertest.NewRunner()
+	runner.Behaviors["diambra-foo-arena-0"] = containertest.Behavior{Output: "env 0\nready"}
+	runner.Behaviors["diambra-foo-arena-1"] = containertest.Behavior{Output: "env 1\nready\n"}
+	require.NoError(t, up(context.Background(), logger, runner, nil, c, &bytes.Buffer{}, "text"))
+
+	for _, tc := range []struct {
+		name    string
+		session string
+		env     int
+		want    string
+		err     string
+	}{
+		{name: "all", env: -1, want: "arena-0 | env 0\narena-0 | ready\narena-1 | env 1\narena-1 | ready\n"},
+		{name: "session", session: "foo", env: -1, want: "arena-0 | env 0\narena-0 | ready\narena-1 | env 1\narena-1 | ready\n"},
+		{name: "single env", env: 1, want: "env 1\nready\n"},
+		{name: "unknown env", env: 2, err: "env 2 not found"},
+		{name: "unknown session", session: "bar", env: -1, err: "no environments found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := logs(context.Background(), runner, out, tc.session, tc.env, container.LogsOptions{})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, out.String())
+		})
+	}
+
+	// Envs of other sessions require selecting one.
+	c.Session = "bar"
+	require.NoError(t, up(context.Background(), logger, runner, nil, c, &bytes.Buffer{}, "text"))
+	assert.EqualError(t, logs(context.Background(), runner, &bytes.Buffer{}, "", -1, container.LogsOptions{}), "multiple sessions found (bar, foo), select one with --session")
+}
+
+func TestLogsFollow(t *testing.T) {
+	logger := log.New()
+	c := cmdtest.NewConfig(t, logger)
+	c.Scale = 2
+	c.Session = "foo"
+	runner := containertest.NewRunner()
+	runner.Behaviors["diambra/engine:test"] = containertest.Behavior{Output: "ready\n"}
+	require.NoError(t, up(context.Background(), logger, runner, nil, c, &bytes.Buffer{}, "text"))
+
+	out := &bytes.Buffer{}
+	done := make(chan error)
+	go func() {
+		done <- logs(context.Background(), runner, out, "foo", -1, container.LogsOptions{Follow: true})
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("logs returned before envs exited: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.NoError(t, runner.StopAll(context.Background(), "foo"))
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("logs didn't return after envs exited")
+	}
+	assert.Contains(t, out.String(), "arena-0 | ready\n")
+	assert.Contains(t, out.String(), "arena-1 | ready\n")
+}
@@ -16,16 +16,144 @@
 package arena
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
 
+	"github.com/diambra/cli/pkg/container"
+	"github.com/diambra/cli/pkg/diambra"
+	"github.com/diambra/cli/pkg/log"
+	"github.com/go-kit/log/level"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 )
 
-var StatusCmd = &cobra.Command{
-	Use:   "status",
-	Short: "Show status of DIAMBRA arena",
-	Long:  `This shows the status of DIAMBRA arena`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("status called")
-	},
+const probeTimeout = time.Second
+
+type EnvStatus struct {
+	ID               string    `json:"id" yaml:"id"`
+	Name             string    `json:"name" yaml:"name"`
+	Session          string    `json:"session" yaml:"session"`
+	Image            string    `json:"image" yaml:"image"`
+	Address          string    `json:"address" yaml:"address"`                     // host:port to connect to from this host
+	ContainerAddress string    `json:"container_address" yaml:"container_address"` // containerIP:containerPort
+	State            string    `json:"state" yaml:"state"`
+	StartedAt        time.Time `json:"started_at" yaml:"started_at"`
+	Uptime           string    `json:"uptime" yaml:"uptime"`
+	AutoRemove       bool      `json:"auto_remove" yaml:"auto_remove"`
+	Reachable        bool      `json:"reachable" yaml:"reachable"`
+}
+
+func NewStatusCmd(logger *log.Logger, runtime *container.Runtime) *cobra.Command {
+	output := "table"
+	session := ""
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show status of DIAMBRA arena",
+		Long: `This shows the status of all DIAMBRA arena environments.
+
+The address column lists the endpoints as used in DIAMBRA_ENVS.
+Without --session, the environments of all sessions are shown.
+Records of sessions that aren't running anymore get removed.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			runner, err := container.NewRunner(logger, *runtime, true)
+			if err != nil {
+				level.Error(logger).Log("msg", "failed to create runner", "err", err.Error())
+				os.Exit(1)
+			}
+			home, err := os.UserHomeDir()
+			if err != nil {
+				level.Error(logger).Log("msg", "couldn't get homedir", "err", err.Error())
+				os.Exit(1)
+			}
+			if err := status(cmd.Context(), logger, runner, os.Stdout, diambra.SessionsDir(home), session, output); err != nil {
+				level.Error(logger).Log("msg", "failed to get status", "err", err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", output, "Output format (table, json, yaml)")
+	cmd.Flags().StringVar(&session, "session", session, "Only show the environments of this session")
+	return cmd
+}
+
+func status(ctx context.Context, logger *log.Logger, runner container.Runner, out io.Writer, sessionsDir, session, output string) error {
+	switch output {
+	case "table", "json", "yaml":
+	default:
+		return fmt.Errorf("invalid output format %s", output)
+	}
+	if err := diambra.PruneSessionStates(ctx, logger, runner, sessionsDir); err != nil {
+		level.Warn(logger).Log("msg", "couldn't remove records of stopped sessions", "err", err.Error())
+	}
+
+	infos, err := runner.List(ctx, session)
+	if err != nil {
+		return err
+	}
+	statuses := make([]*EnvStatus, 0, len(infos))
+	for _, info := range infos {
+		s := &EnvStatus{
+			ID:         info.ID,
+			Name:       info.Name,
+			Session:    info.Labels[container.LabelSession],
+			Image:      info.Image,
+			State:      info.State,
+			StartedAt:  info.StartedAt,
+			AutoRemove: info.AutoRemove,
+		}
+		if info.State == "running" && !info.StartedAt.IsZero() {
+			s.Uptime = time.Since(info.StartedAt).Round(time.Second).String()
+		}
+		if addr, ok := (*info.PortMapping)[diambra.ContainerPort]; ok {
+			if s.Address, err = diambra.HostAddress(addr); err != nil {
+				return err
+			}
+			port, err := container.Port(diambra.ContainerPort).Number()
+			if err != nil {
+				return err
+			}
+			if info.Address != "" {
+				s.ContainerAddress = fmt.Sprintf("%s:%d", info.Address, port)
+			}
+		}
+		if s.Address != "" && info.State == "running" {
+			pctx, cancel := context.WithTimeout(ctx, probeTimeout)
+			err := diambra.Probe(pctx, s.Address)
+			cancel()
+			if err != nil {
+				level.Debug(logger).Log("msg", "env not reachable", "id", info.ID, "address", s.Address, "err", err.Error())
+			}
+			s.Reachable = err == nil
+		}
+		statuses = append(statuses, s)
+	}
+
+	switch output {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	case "yaml":
+		b, err := yaml.Marshal(statuses)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(b)
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSESSION\tIMAGE\tADDRESS\tCONTAINER ADDRESS\tUPTIME\tSTATE\tAUTOREMOVE\tREACHABLE")
+	for _, s := range statuses {
+		id := s.ID
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%t\t%t\n", id, s.Session, s.Image, s.Address, s.ContainerAddress, s.Uptime, s.State, s.AutoRemove, s.Reachable)
+	}
+	return tw.Flush()
 }
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package arena
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/diambra/cli/pkg/container"
+	"github.com/diambra/cli/pkg/container/containertest"
+	"github.com/diambra/cli/pkg/diambra"
+	"github.com/diambra/cli/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func startEnv(t *testing.T, runner *containertest.Runner, name, session string, port int) {
+	pm := &container.PortMapping{}
+	pm.AddPortMapping(diambra.ContainerPort, fmt.Sprintf("%d", port), "127.0.0.1")
+	_, err := runner.Start(context.Background(), &container.Container{
+		Name:        name,
+		Image:       "diambra/engine:test",
+		PortMapping: pm,
+		Labels:      map[string]string{container.LabelSession: session},
+	})
+	require.NoError(t, err)
+}
+
+func TestStatus(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	go srv.Serve(lis) //nolint:errcheck
+	defer srv.Stop()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, closed.Close())
+	exited, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, exited.Close())
+
+	runner := containertest.NewRunner()
+	runner.Behaviors["broken"] = containertest.Behavior{NotServing: true}
+	startEnv(t, runner, "ok", "a", lis.Addr().(*net.TCPAddr).Port)
+	startEnv(t, runner, "broken", "a", closed.Addr().(*net.TCPAddr).Port)
+	startEnv(t, runner, "exited", "b", exited.Addr().(*net.TCPAddr).Port)
+	runner.Containers()[2].Exit(1)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, status(context.Background(), log.New(), runner, out, t.TempDir(), "", "json"))
+	statuses := []*EnvStatus{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &statuses))
+	require.Len(t, statuses, 3)
+
+	assert.Equal(t, lis.Addr().String(), statuses[0].Address)
+	assert.Equal(t, "172.17.0.2:50051", statuses[0].ContainerAddress)
+	assert.Equal(t, "running", statuses[0].State)
+	assert.Equal(t, "a", statuses[0].Session)
+	assert.True(t, statuses[0].Reachable)
+	assert.NotEmpty(t, statuses[0].Uptime)
+
+	assert.False(t, statuses[1].Reachable)
+	assert.Equal(t, "exited", statuses[2].State)
+	assert.Empty(t, statuses[2].Uptime)
+
+	out.Reset()
+	require.NoError(t, status(context.Background(), log.New(), runner, out, t.TempDir(), "b", "json"))
+	statuses = []*EnvStatus{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &statuses))
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "b", statuses[0].Session)
+
+	out.Reset()
+	require.NoError(t, status(context.Background(), log.New(), runner, out, t.TempDir(), "", "table"))
+	assert.Contains(t, out.String(), "CONTAINER ADDRESS")
+	assert.Contains(t, out.String(), lis.Addr().String())
+
+	assert.Error(t, status(context.Background(), log.New(), runner, out, t.TempDir(), "", "xml"))
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package arena
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/diambra/cli/pkg/container"
+	"github.com/diambra/cli/pkg/log"
+	"github.com/docker/go-units"
+	"github.com/go-kit/log/level"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// clearScreen moves the cursor home and clears the terminal.
+const clearScreen = "\033[H\033[2J"
+
+type EnvStats struct {
+	ID            string  `json:"id" yaml:"id"`
+	Name          string  `json:"name" yaml:"name"`
+	Session       string  `json:"session" yaml:"session"`
+	State         string  `json:"state" yaml:"state"`
+	CPUPercent    float64 `json:"cpu_percent" yaml:"cpu_percent"`
+	MemoryUsage   uint64  `json:"memory_usage" yaml:"memory_usage"` // bytes
+	MemoryLimit   uint64  `json:"memory_limit" yaml:"memory_limit"` // bytes
+	MemoryPercent float64 `json:"memory_percent" yaml:"memory_percent"`
+	NetworkRx     uint64  `json:"network_rx" yaml:"network_rx"` // bytes
+	NetworkTx     uint64  `json:"network_tx" yaml:"network_tx"` // bytes
+	Restarts      int     `json:"restarts" yaml:"restarts"`
+}
+
+func NewTopCmd(logger *log.Logger, runtime *container.Runtime) *cobra.Command {
+	var (
+		output   = "table"
+		session  = ""
+		once     = false
+		interval = 2 * time.Second
+	)
+	cmd := &cobra.Command{
+		Use:   "top",
+		Short: "Show resource usage of DIAMBRA arena",
+		Long: `This shows the CPU, memory and network usage and the number of restarts of
+all DIAMBRA arena containers, refreshed until interrupted.
+
+Use --once to show a single snapshot, e.g. with -o json for scripts.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			runner, err := container.NewRunner(logger, *runtime, true)
+			if err != nil {
+				level.Error(logger).Log("msg", "failed to create runner", "err", err.Error())
+				os.Exit(1)
+			}
+			if err := top(cmd.Context(), logger, runner, os.Stdout, session, output, once, interval); err != nil {
+				level.Error(logger).Log("msg", "failed to get resource usage", "err", err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", output, "Output format (table, json, yaml). json and yaml require --once")
+	cmd.Flags().StringVar(&session, "session", session, "Only show the containers of this session")
+	cmd.Flags().BoolVar(&once, "once", once, "Show a single snapshot instead of refreshing")
+	cmd.Flags().DurationVar(&interval, "interval", interval, "Time between refreshes")
+	return cmd
+}
+
+func top(ctx context.Context, logger *log.Logger, runner container.Runner, out io.Writer, session, output string, once bool, interval time.Duration) error {
+	switch output {
+	case "table":
+	case "json", "yaml":
+		if !once {
+			return fmt.Errorf("output format %s requires --once", output)
+		}
+	default:
+		return fmt.Errorf("invalid output format %s", output)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval %s", interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		stats, err := snapshot(ctx, logger, runner, session)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if !once {
+			if _, err := io.WriteString(out, clearScreen); err != nil {
+				return err
+			}
+		}
+		if err := writeStats(out, stats, output); err != nil {
+			return err
+		}
+		if once {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshot returns the resource usage of all containers of the session, or of
+// all sessions if session is empty.
+func snapshot(ctx context.Context, logger *log.Logger, runner container.Runner, session string) ([]*EnvStats, error) {
+	infos, err := runner.List(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]*EnvStats, len(infos))
+	var wg sync.WaitGroup
+	for i, info := range infos {
+		stats[i] = &EnvStats{
+			ID:       info.ID,
+			Name:     info.Name,
+			Session:  info.Labels[container.LabelSession],
+			State:    info.State,
+			Restarts: info.Restarts,
+		}
+		if info.State != "running" {
+			continue
+		}
+		// Getting the stats takes a moment per container, so get them all at once.
+		wg.Add(1)
+		go func(s *EnvStats) {
+			defer wg.Done()
+			cs, err := runner.Stats(ctx, s.ID)
+			if err != nil {
+				// Most likely exited in the meantime.
+				level.Debug(logger).Log("msg", "couldn't get container stats", "id", s.ID, "err", err.Error())
+				return
+			}
+			s.CPUPercent = cs.CPUPercent
+			s.MemoryUsage = cs.MemoryUsage
+			s.MemoryLimit = cs.MemoryLimit
+			s.MemoryPercent = cs.MemoryPercent()
+			s.NetworkRx = cs.NetworkRx
+			s.NetworkTx = cs.NetworkTx
+		}(stats[i])
+	}
+	wg.Wait()
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Session != stats[j].Session {
+			return stats[i].Session < stats[j].Session
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats, nil
+}
+
+func writeStats(out io.Writer, stats []*EnvStats, output string) error {
+	switch output {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	case "yaml":
+		b, err := yaml.Marshal(stats)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(b)
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSESSION\tSTATE\tCPU %\tMEM USAGE / LIMIT\tMEM %\tNET I/O\tRESTARTS")
+	for _, s := range stats {
+		if s.State != "running" {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t--\t-- / --\t--\t-- / --\t%d\n", s.Name, s.Session, s.State, s.Restarts)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f%%\t%s / %s\t%.2f%%\t%s / %s\t%d\n",
+			s.Name, s.Session, s.State,
+			s.CPUPercent,
+			units.BytesSize(float64(s.MemoryUsage)), units.BytesSize(float64(s.MemoryLimit)),
+			s.MemoryPercent,
+			units.HumanSize(float64(s.NetworkRx)), units.HumanSize(float64(s.NetworkTx)),
+			s.Restarts,
+		)
+	}
+	return tw.Flush()
+}
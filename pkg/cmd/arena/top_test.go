@@ -0,0 +1,108 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package arena
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diambra/cli/pkg/container"
+	"github.com/diambra/cli/pkg/container/containertest"
+	"github.com/diambra/cli/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTopRunner(t *testing.T) *containertest.Runner {
+	runner := containertest.NewRunner()
+	runner.Behaviors["busy"] = containertest.Behavior{Stats: container.ContainerStats{
+		CPUPercent:  150,
+		MemoryUsage: 512 * 1024 * 1024,
+		MemoryLimit: 2 * 1024 * 1024 * 1024,
+		NetworkRx:   1000,
+		NetworkTx:   2000,
+	}}
+	for _, c := range []*container.Container{
+		{Name: "busy", Labels: map[string]string{container.LabelSession: "a", container.LabelRestarts: "2"}},
+		{Name: "idle", Labels: map[string]string{container.LabelSession: "a"}},
+		{Name: "other", Labels: map[string]string{container.LabelSession: "b"}},
+	} {
+		_, err := runner.Start(context.Background(), c)
+		require.NoError(t, err)
+	}
+	runner.Containers()[2].Exit(1)
+	return runner
+}
+
+func TestTopOnce(t *testing.T) {
+	runner := newTopRunner(t)
+	out := &bytes.Buffer{}
+	require.NoError(t, top(context.Background(), log.New(), runner, out, "", "json", true, time.Second))
+	stats := []*EnvStats{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &stats))
+	require.Len(t, stats, 3)
+
+	assert.Equal(t, &EnvStats{
+		ID:            "container-0",
+		Name:          "busy",
+		Session:       "a",
+		State:         "running",
+		CPUPercent:    150,
+		MemoryUsage:   512 * 1024 * 1024,
+		MemoryLimit:   2 * 1024 * 1024 * 1024,
+		MemoryPercent: 25,
+		NetworkRx:     1000,
+		NetworkTx:     2000,
+		Restarts:      2,
+	}, stats[0])
+	assert.Equal(t, "idle", stats[1].Name)
+	assert.Equal(t, "other", stats[2].Name)
+	assert.Equal(t, "exited", stats[2].State)
+	// Stats are only requested for running containers.
+	assert.Equal(t, 2, runner.Calls(containertest.StepStats))
+
+	out.Reset()
+	require.NoError(t, top(context.Background(), log.New(), runner, out, "b", "table", true, time.Second))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, []string{"other", "b", "exited", "--", "--", "/", "--", "--", "--", "/", "--", "0"}, strings.Fields(lines[1]))
+
+	out.Reset()
+	require.NoError(t, top(context.Background(), log.New(), runner, out, "a", "table", true, time.Second))
+	assert.Contains(t, out.String(), "150.00%")
+	assert.Contains(t, out.String(), "512MiB / 2GiB")
+	assert.Contains(t, out.String(), "25.00%")
+	assert.Contains(t, out.String(), "1kB / 2kB")
+}
+
+func TestTopRefresh(t *testing.T) {
+	runner := newTopRunner(t)
+	out := &bytes.Buffer{}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.NoError(t, top(ctx, log.New(), runner, out, "a", "table", false, 10*time.Millisecond))
+	assert.Greater(t, strings.Count(out.String(), clearScreen), 1)
+}
+
+func TestTopInvalid(t *testing.T) {
+	runner := containertest.NewRunner()
+	assert.EqualError(t, top(context.Background(), log.New(), runner, &bytes.Buffer{}, "", "json", false, time.Second), "output format json requires --once")
+	assert.EqualError(t, top(context.Background(), log.New(), runner, &bytes.Buffer{}, "", "xml", true, time.Second), "invalid output format xml")
+}
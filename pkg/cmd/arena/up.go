@@ -16,7 +16,10 @@
 package arena
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 
@@ -28,7 +31,7 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func NewUpCmd(logger *log.Logger) *cobra.Command {
+func NewUpCmd(logger *log.Logger, runtime *container.Runtime) *cobra.Command {
 	c, err := diambra.NewConfig(logger)
 	if err != nil {
 		level.Error(logger).Log("msg", err.Error())
@@ -39,13 +42,16 @@ func NewUpCmd(logger *log.Logger) *cobra.Command {
 		c.Tty = true
 	}
 
+	output := "text"
 	cmd := &cobra.Command{
 		Use:   "up",
 		Short: "Start DIAMBRA arena",
-		Long:  `This command starts DIAMBRA arena in the background and prints the address for each environment started.`,
+		Long: `This command starts DIAMBRA arena in the background and prints the address for each environment started.
+
+With -o json, it prints the session instead, including the seed of each env.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			level.Debug(logger).Log("config", fmt.Sprintf("%#v", c))
-			if err := RunFn(logger, c, args); err != nil {
+			if err := RunFn(cmd.Context(), logger, *runtime, c, output, args); err != nil {
 				if exitErr, ok := err.(*exec.ExitError); ok {
 					code := exitErr.ExitCode()
 					if code != 0 {
@@ -60,31 +66,55 @@ func NewUpCmd(logger *log.Logger) *cobra.Command {
 	}
 
 	c.AddFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&output, "output", "o", output, "Output format (text, json)")
 
 	return cmd
 }
 
-func RunFn(logger *log.Logger, c *diambra.EnvConfig, args []string) error {
+func RunFn(ctx context.Context, logger *log.Logger, runtime container.Runtime, c *diambra.EnvConfig, output string, args []string) error {
 	level.Debug(logger).Log("config", fmt.Sprintf("%#v", c))
 
-	runner, err := container.NewDockerRunner(logger, c.AutoRemove)
+	runner, err := container.NewRunner(logger, runtime, c.AutoRemove)
 	if err != nil {
 		return err
 	}
-	d, err := diambra.NewDiambra(logger, console.Current(), runner, c)
+	return up(ctx, logger, runner, console.Current(), c, os.Stdout, output)
+}
+
+func up(ctx context.Context, logger *log.Logger, runner container.Runner, console console.Console, c *diambra.EnvConfig, out io.Writer, output string) error {
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid output format %s", output)
+	}
+	if c.Restart != diambra.RestartNo {
+		level.Warn(logger).Log("msg", "--env.restart has no effect in the background, use it with run instead")
+	}
+	if c.LogFiles.Dir != "" {
+		level.Warn(logger).Log("msg", "--log.dir has no effect in the background, use arena logs instead")
+	}
+	d, err := diambra.NewDiambra(logger, console, runner, c)
 	if err != nil {
 		return fmt.Errorf("couldn't create DIAMBRA Env: %w", err)
 	}
 
 	level.Debug(logger).Log("msg", "starting DIAMBRA env")
-	if err := d.Start(); err != nil {
+	if err := d.Start(ctx); err != nil {
 		return fmt.Errorf("could't start DIAMBRA Env: %w", err)
 	}
 
+	level.Info(logger).Log("msg", "DIAMBRA arena started", "session", d.Session())
+	if output == "json" {
+		state, err := d.State()
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(state)
+	}
 	envs, err := d.EnvsString()
 	if err != nil {
 		return err
 	}
-	fmt.Println(envs)
+	fmt.Fprintln(out, envs)
 	return nil
 }
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package arena
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/diambra/cli/pkg/cmd/cmdtest"
+	"github.com/diambra/cli/pkg/container/containertest"
+	"github.com/diambra/cli/pkg/diambra"
+	"github.com/diambra/cli/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp(t *testing.T) {
+	logger := log.New()
+	c := cmdtest.NewConfig(t, logger)
+	c.Scale = 2
+	runner := containertest.NewRunner()
+	out := &bytes.Buffer{}
+
+	require.NoError(t, up(context.Background(), logger, runner, nil, c, out, "text"))
+	ct := runner.Containers()
+	require.Len(t, ct, 2)
+	assert.Equal(t, ct[0].Endpoint(diambra.ContainerPort)+" "+ct[1].Endpoint(diambra.ContainerPort)+"\n", out.String())
+	// The arena keeps running in the background.
+	assert.Len(t, runner.Running(), 2)
+}
+
+func TestUpFailure(t *testing.T) {
+	logger := log.New()
+	c := cmdtest.NewConfig(t, logger)
+	runner := containertest.NewRunner()
+	errFail := errors.New("scripted failure")
+	runner.FailAt(containertest.StepPull, 1, errFail)
+	out := &bytes.Buffer{}
+
+	assert.ErrorIs(t, up(context.Background(), logger, runner, nil, c, out, "text"), errFail)
+	assert.Empty(t, out.String())
+	assert.Empty(t, runner.Containers())
+}
+
+func TestUpSession(t *testing.T) {
+	logger := log.New()
+	c := cmdtest.NewConfig(t, logger)
+	c.Scale = 2
+	c.Session = "foo"
+	runner := containertest.NewRunner()
+	out := &bytes.Buffer{}
+
+	require.NoError(t, up(context.Background(), logger, runner, nil, c, out, "text"))
+	ct := runner.Containers()
+	require.Len(t, ct, 2)
+	assert.Equal(t, "diambra-foo-arena-0", ct[0].Name)
+	assert.Equal(t, "diambra-foo-arena-1", ct[1].Name)
+	envs := out.String()
+
+	// Bringing up the same session again reuses the running envs.
+	out.Reset()
+	require.NoError(t, up(context.Background(), logger, runner, nil, c, out, "text"))
+	assert.Equal(t, envs, out.String())
+	assert.Len(t, runner.Containers(), 2)
+
+	// Other sessions are independent.
+	c.Session = "bar"
+	out.Reset()
+	require.NoError(t, up(context.Background(), logger, runner, nil, c, out, "text"))
+	ct = runner.Containers()
+	require.Len(t, ct, 4)
+	assert.Equal(t, ct[2].Endpoint(diambra.ContainerPort)+" "+ct[3].Endpoint(diambra.ContainerPort)+"\n", out.String())
+	assert.Len(t, runner.Running(), 4)
+
+	assert.Equal(t, []string{"diambra-bar", "diambra-foo"}, runner.Networks())
+	require.NoError(t, runner.StopAll(context.Background(), "foo"))
+	assert.Equal(t, []string{"diambra-bar"}, runner.Networks())
+	for _, ct := range runner.Running() {
+		assert.Equal(t, "bar", ct.Labels["diambra.session"])
+	}
+	assert.Len(t, runner.Running(), 2)
+}
+
+func TestUpSeeds(t *testing.T) {
+	logger := log.New()
+	c := cmdtest.NewConfig(t, logger)
+	c.Scale = 3
+	c.Seed = 100
+	c.EnvSeeds = map[string]int{"1": 7}
+	runner := containertest.NewRunner()
+	out := &bytes.Buffer{}
+
+	require.NoError(t, up(context.Background(), logger, runner, nil, c, out, "json"))
+	state := &diambra.SessionState{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), state))
+	require.Len(t, state.Envs, 3)
+	assert.Equal(t, 100, state.Config.Seed)
+	ct := runner.Containers()
+	for i, seed := range []int{100, 7, 102} {
+		assert.Equal(t, i, state.Envs[i].Index)
+		assert.Equal(t, seed, state.Envs[i].Seed)
+		assert.Equal(t, ct[i].Endpoint(diambra.ContainerPort), state.Envs[i].Address)
+		assert.Contains(t, strings.Join(ct[i].Args, " "), fmt.Sprintf("--randomSeed %d", seed))
+	}
+
+	assert.EqualError(t, up(context.Background(), logger, runner, nil, c, out, "xml"), "invalid output format xml")
+}
@@ -17,9 +17,12 @@ package cmd
 
 import (
 	"os"
+	"strings"
 
 	"github.com/diambra/cli/pkg/cmd/agent"
 	"github.com/diambra/cli/pkg/cmd/arena"
+	"github.com/diambra/cli/pkg/config"
+	"github.com/diambra/cli/pkg/container"
 	"github.com/diambra/cli/pkg/log"
 	"github.com/diambra/cli/pkg/version"
 	"github.com/go-kit/log/level"
@@ -33,6 +36,8 @@ func NewDiambraCommand() *cobra.Command {
 
 		logFormat = ""
 		debug     = false
+		profile   = ""
+		runtime   = container.RuntimeDocker
 		cmd       = &cobra.Command{
 			Use:   "diambra",
 			Short: "The DIAMBRA cli",
@@ -43,10 +48,22 @@ func NewDiambraCommand() *cobra.Command {
 - Run 'diambra agent submit registry/user/agent:latest' to submit your agent to DIAMBRA
 `,
 			PersistentPreRun: func(cmd *cobra.Command, args []string) {
+				// Apply the config first, it can set the log flags too.
+				applied, cerr := applyConfig(cmd, profile)
 				if err := logger.SetOptions(debug, logFormat); err != nil {
 					level.Error(logger).Log("msg", err.Error())
 					os.Exit(1)
 				}
+				if cerr != nil {
+					level.Error(logger).Log("msg", "failed to apply config", "err", cerr.Error())
+					os.Exit(1)
+				}
+				if applied.Profile != "" {
+					level.Debug(logger).Log("msg", "using config profile", "profile", applied.Profile)
+				}
+				if len(applied.Unused) > 0 {
+					level.Debug(logger).Log("msg", "ignoring config options without flag in this command", "options", strings.Join(applied.Unused, ","))
+				}
 			},
 			Version: version.String(),
 		}
@@ -54,9 +71,34 @@ func NewDiambraCommand() *cobra.Command {
 
 	cmd.PersistentFlags().BoolVarP(&debug, "log.debug", "d", false, "Enable debug logging")
 	cmd.PersistentFlags().StringVar(&logFormat, "log.format", "fancy", "Set logging output format (logfmt, json, fancy)")
+	cmd.PersistentFlags().Var(&runtime, "runtime", "Container runtime to use (docker, podman)")
+	cmd.PersistentFlags().StringVar(&profile, config.ProfileFlag, "", "Profile of "+config.UserFile("~")+" and ./"+config.ProjectFile+" to use. Defaults to the profile set in the files or the \"default\" profile")
+	config.BindEnv(cmd.PersistentFlags())
 
-	cmd.AddCommand(NewCmdRun(logger))
-	cmd.AddCommand(agent.NewCommand(logger))
-	cmd.AddCommand(arena.NewCommand(logger))
+	cmd.AddCommand(NewCmdRun(logger, &runtime))
+	cmd.AddCommand(agent.NewCommand(logger, &runtime))
+	cmd.AddCommand(arena.NewCommand(logger, &runtime))
+	cmd.AddCommand(NewCmdConfig(logger))
 	return cmd
 }
+
+// loadConfig loads the config files of the user and the working directory.
+func loadConfig() (*config.Config, error) {
+	// Without home, only the project file is used.
+	home, _ := os.UserHomeDir()
+	return config.Load(home, ".")
+}
+
+// applyConfig sets the flags of cmd that weren't given on the command line from
+// the environment and the config files.
+func applyConfig(cmd *cobra.Command, profile string) (*config.Applied, error) {
+	c, err := loadConfig()
+	if err != nil {
+		return &config.Applied{}, err
+	}
+	applied, err := c.Apply(cmd.Flags(), profile)
+	if applied == nil {
+		applied = &config.Applied{}
+	}
+	return applied, err
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cmdtest provides helpers for the tests of the commands.
+package cmdtest
+
+import (
+	"testing"
+
+	"github.com/diambra/cli/pkg/diambra"
+	"github.com/diambra/cli/pkg/diambra/diambratest"
+	"github.com/diambra/cli/pkg/log"
+)
+
+// NewConfig returns a config of a single env that passes validation without
+// network access, see diambratest.Setup.
+func NewConfig(t testing.TB, logger *log.Logger) *diambra.EnvConfig {
+	t.Helper()
+	f := diambratest.Setup(t)
+	c, err := diambra.NewConfig(logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Scale = 1
+	c.RomsPath = f.RomsPath
+	c.CredPath = f.CredPath
+	c.SessionsDir = f.SessionsDir
+	c.Image = diambratest.Image
+	c.Host = diambratest.Host
+	return c
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/diambra/cli/pkg/config"
+	"github.com/diambra/cli/pkg/diambra"
+	"github.com/diambra/cli/pkg/log"
+	"github.com/go-kit/log/level"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const redacted = "<redacted>"
+
+// defaultShowCommand is the command config show shows the configuration of by
+// default. Its options include those of run and the submission options.
+var defaultShowCommand = []string{"agent", "test"}
+
+func NewCmdConfig(logger *log.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+	cmd.AddCommand(NewCmdConfigShow(logger))
+	return cmd
+}
+
+func NewCmdConfigShow(logger *log.Logger) *cobra.Command {
+	return &cobra.Command{
+		Use:   "show [command] [flags]",
+		Short: "Show the effective configuration of a command",
+		Long: `This shows the value of every option of the given command, e.g. 'arena up',
+and where it came from: its default, a flag, an environment variable, a config
+file or auto-detection. Flags given after the command are taken into account.
+Without command, the configuration of 'agent test' is shown, which has all
+options of 'run' and the submission options.
+
+Secrets are redacted.`,
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, arg := range args {
+				if arg == "-h" || arg == "--help" {
+					cmd.Help() //nolint:errcheck
+					return
+				}
+			}
+			c, err := loadConfig()
+			if err != nil {
+				level.Error(logger).Log("msg", "failed to load config", "err", err.Error())
+				os.Exit(1)
+			}
+			if err := configShow(logger, cmd.Root(), os.Stdout, c, args); err != nil {
+				level.Error(logger).Log("msg", "failed to show config", "err", err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+// configShow writes the options of the command of root given by args, with
+// the config applied.
+func configShow(logger *log.Logger, root *cobra.Command, out io.Writer, c *config.Config, args []string) error {
+	target, rest, err := root.Find(args)
+	if err == nil && target == root {
+		target, rest, err = root.Find(append(defaultShowCommand, args...))
+	}
+	if err != nil {
+		return err
+	}
+	if err := target.ParseFlags(rest); err != nil {
+		return fmt.Errorf("invalid flags for %s: %w", target.CommandPath(), err)
+	}
+	flags := target.Flags()
+	profile, _ := flags.GetString(config.ProfileFlag)
+	applied, err := c.Apply(flags, profile)
+	if err != nil {
+		return err
+	}
+
+	if applied.Profile == "" {
+		fmt.Fprintf(out, "Command: %s\nProfile: none\n\n", target.CommandPath())
+	} else {
+		fmt.Fprintf(out, "Command: %s\nProfile: %s\n\n", target.CommandPath(), applied.Profile)
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPTION\tVALUE\tSOURCE")
+	flags.VisitAll(func(f *pflag.Flag) {
+		// Only options that can be configured, see config.BindEnv.
+		if len(config.EnvVars(f)) == 0 || f.Deprecated != "" {
+			return
+		}
+		value, origin := showValue(f), applied.Origins[f.Name]
+		if f.Name == "env.image" && value == "" {
+			image, detected := diambra.DetectImage(logger)
+			value = image
+			origin = config.Origin{Source: config.SourceDetected, Name: "from diambra-engine version"}
+			if !detected {
+				origin = config.Origin{Source: config.SourceDefault, Name: "(diambra-engine not found)"}
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Name, value, origin)
+	})
+	return tw.Flush()
+}
+
+// showValue returns the value of the flag with secrets redacted.
+func showValue(f *pflag.Flag) string {
+	value := f.Value.String()
+	switch f.Value.Type() {
+	case "stringToString":
+		// Values are formatted as [k=v,...] with csv quoting.
+		pairs, err := csv.NewReader(strings.NewReader(strings.Trim(value, "[]"))).Read()
+		if err != nil {
+			break
+		}
+		for i, pair := range pairs {
+			k, v, _ := strings.Cut(pair, "=")
+			if config.IsSecret(f) {
+				v = redacted
+			}
+			pairs[i] = k + "=" + redactURL(v)
+		}
+		return "[" + strings.Join(pairs, ",") + "]"
+	}
+	if config.IsSecret(f) && value != "" {
+		return redacted
+	}
+	return redactURL(value)
+}
+
+// redactURL replaces the password of an url with credentials.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+	return u.Redacted()
+}
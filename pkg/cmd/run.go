@@ -16,6 +16,7 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -32,7 +33,7 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func NewCmdRun(logger *log.Logger) *cobra.Command {
+func NewCmdRun(logger *log.Logger, runtime *container.Runtime) *cobra.Command {
 	c, err := diambra.NewConfig(logger)
 	if err != nil {
 		level.Error(logger).Log("msg", err.Error())
@@ -51,9 +52,12 @@ func NewCmdRun(logger *log.Logger) *cobra.Command {
 It will set the DIAMBRA_ENVS environment variable to list the endpoints of all running environments.
 The DIAMBRA arena python package will automatically be configured by this.
 
+With --env.group, DIAMBRA_ENVS lists the environments of all groups in the
+order the groups are given, and DIAMBRA_ENVS_<NAME> those of each group.
+
 The flag --agent-image can be used to run the commands in the given image.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := RunFn(logger, c, args); err != nil {
+			if err := RunFn(logger, *runtime, c, args); err != nil {
 				if exitErr, ok := err.(*exec.ExitError); ok {
 					code := exitErr.ExitCode()
 					if code != 0 {
@@ -68,75 +72,97 @@ The flag --agent-image can be used to run the commands in the given image.`,
 	}
 
 	c.AddFlags(cmd.Flags())
+	c.AddAttachSessionFlag(cmd.Flags())
 	cmd.Flags().SetInterspersed(false)
 	return cmd
 }
 
-func RunFn(logger *log.Logger, c *diambra.EnvConfig, args []string) error {
+func RunFn(logger *log.Logger, runtime container.Runtime, c *diambra.EnvConfig, args []string) error {
 	level.Debug(logger).Log("config", fmt.Sprintf("%#v", c))
 
-	runner, err := container.NewDockerRunner(logger, c.AutoRemove)
+	runner, err := container.NewRunner(logger, runtime, c.AutoRemove)
 	if err != nil {
 		return err
 	}
-	console := console.Current()
+	return run(logger, runner, console.Current(), c, args)
+}
+
+func run(logger *log.Logger, runner container.Runner, console console.Console, c *diambra.EnvConfig, args []string) error {
 	d, err := diambra.NewDiambra(logger, console, runner, c)
 	if err != nil {
 		return fmt.Errorf("couldn't create DIAMBRA Env: %w", err)
 	}
 	defer func() {
-		if err := d.Cleanup(); err != nil {
+		if err := d.Cleanup(context.Background()); err != nil {
 			level.Error(logger).Log("msg", "Couldn't cleanup DIAMBRA Env", "err", err.Error())
 		}
 	}()
-	var (
-		signalCh = make(chan os.Signal, 1)
-		ex       *exec.Cmd
-	)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		s := <-signalCh
 		level.Info(logger).Log("msg", "Received signal, terminating", "signal", s)
-		if err := console.Reset(); err != nil {
-			level.Error(logger).Log("msg", "Couldn't reset console", "err", err.Error())
-		}
-		if err := d.Cleanup(); err != nil {
-			level.Error(logger).Log("msg", "cleanup failed", "err", err.Error())
-		}
-		if ex != nil {
-			if err := ex.Process.Kill(); err != nil {
-				level.Error(logger).Log("msg", "Couldn't kill process", "err", err.Error())
+		if console != nil {
+			if err := console.Reset(); err != nil {
+				level.Error(logger).Log("msg", "Couldn't reset console", "err", err.Error())
 			}
 		}
-		os.Exit(1)
+		cancel(fmt.Errorf("received signal %s", s))
 	}()
 
 	level.Info(logger).Log("msg", "Starting DIAMBRA environment:")
-	if err := d.Start(); err != nil {
+	if err := d.Start(ctx); err != nil {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
 		return err
 	}
 
-	envs, err := d.EnvsString()
+	vars, err := d.EnvVars(false)
 	if err != nil {
 		return err
 	}
 	level.Info(logger).Log("msg", "DIAMBRA environment started")
 
 	if c.AgentImage != "" {
-		return d.RunAgentImage(c.AgentImage, args)
+		if err := d.RunAgentImage(ctx, c.AgentImage, args); err != nil {
+			if ctx.Err() != nil {
+				return context.Cause(ctx)
+			}
+			return err
+		}
+		return nil
 	}
 	if len(args) == 0 {
 		return errors.New("command required when not using --agent-image")
 	}
 
-	ex = exec.Command(args[0], args[1:]...)
+	agentCtx := ctx
+	if c.Timeouts.Agent != 0 {
+		var agentCancel context.CancelFunc
+		agentCtx, agentCancel = context.WithTimeout(ctx, c.Timeouts.Agent)
+		defer agentCancel()
+	}
+	ex := exec.CommandContext(agentCtx, args[0], args[1:]...)
 	ex.Env = os.Environ()
-	ex.Env = append(ex.Env, fmt.Sprintf("DIAMBRA_ENVS=%s", envs))
+	ex.Env = append(ex.Env, vars...)
 	if c.Interactive {
 		ex.Stdin = os.Stdin
 	}
 	ex.Stdout = os.Stdout
 	ex.Stderr = os.Stderr
 	level.Debug(logger).Log("msg", "running command", "args", fmt.Sprintf("%#v", args), "env", fmt.Sprintf("%#v", ex.Env))
-	return ex.Run()
+	if err := ex.Run(); err != nil {
+		switch {
+		case ctx.Err() != nil:
+			return context.Cause(ctx)
+		case errors.Is(agentCtx.Err(), context.DeadlineExceeded):
+			return fmt.Errorf("command didn't finish within %s (--timeout.agent): %w", c.Timeouts.Agent, err)
+		}
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/diambra/cli/pkg/cmd/cmdtest"
+	"github.com/diambra/cli/pkg/container/containertest"
+	"github.com/diambra/cli/pkg/diambra"
+	"github.com/diambra/cli/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	for _, tc := range []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"success", []string{"sh", "-c", `printf %s "$DIAMBRA_ENVS" > "$ENVS_FILE"`}, 0},
+		{"failure", []string{"sh", "-c", "exit 3"}, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			envsFile := filepath.Join(t.TempDir(), "envs")
+			t.Setenv("ENVS_FILE", envsFile)
+			logger := log.New()
+			c := cmdtest.NewConfig(t, logger)
+			c.Scale = 2
+			runner := containertest.NewRunner()
+
+			err := run(logger, runner, nil, c, tc.args)
+			if tc.code == 0 {
+				assert.NoError(t, err)
+				ct := runner.Containers()
+				envs, err := os.ReadFile(envsFile)
+				require.NoError(t, err)
+				assert.Equal(t, ct[0].Endpoint(diambra.ContainerPort)+" "+ct[1].Endpoint(diambra.ContainerPort), string(envs))
+			} else {
+				var exitErr *exec.ExitError
+				require.ErrorAs(t, err, &exitErr)
+				assert.Equal(t, tc.code, exitErr.ExitCode())
+			}
+			assert.Len(t, runner.Containers(), 2)
+			assert.Empty(t, runner.Running())
+		})
+	}
+}
+
+func TestRunAgentImage(t *testing.T) {
+	logger := log.New()
+	c := cmdtest.NewConfig(t, logger)
+	c.AgentImage = "agent:test"
+	runner := containertest.NewRunner()
+	runner.Behaviors["agent:test"] = containertest.Behavior{Exit: true, ExitCode: 1}
+
+	assert.EqualError(t, run(logger, runner, nil, c, []string{"--gameId", "doapp"}), "agent exited with status code 1")
+	containers := runner.Containers()
+	require.Len(t, containers, 2)
+	assert.Equal(t, []string{"--gameId", "doapp"}, containers[1].Args)
+	assert.Empty(t, runner.Running())
+}
+
+func TestRunStartFailure(t *testing.T) {
+	logger := log.New()
+	c := cmdtest.NewConfig(t, logger)
+	c.Scale = 2
+	runner := containertest.NewRunner()
+	errFail := errors.New("scripted failure")
+	runner.FailAt(containertest.StepStart, 2, errFail)
+
+	assert.ErrorIs(t, run(logger, runner, nil, c, []string{"true"}), errFail)
+	assert.Empty(t, runner.Running())
+}
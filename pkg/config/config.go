@@ -0,0 +1,321 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package config sets flags from config files holding named profiles of flag
+// values, e.g:
+//
+//	profile: dev
+//	profiles:
+//	  dev:
+//	    env.scale: 4
+//	    engine:
+//	      render: true
+//	    env.mount:
+//	      - /data:/data
+//
+// Nested keys are joined with dots, so both forms above set --<key> of the
+// command.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// ProjectFile is the name of the project config file, looked up in the
+	// working directory.
+	ProjectFile = "diambra.yaml"
+	// DefaultProfile is used if no profile is selected and the files have one
+	// by that name.
+	DefaultProfile = "default"
+	// ProfileFlag is the name of the flag selecting the profile.
+	ProfileFlag = "profile"
+)
+
+// UserFile returns the path of the config file of the user.
+func UserFile(home string) string {
+	return filepath.Join(home, ".diambra", "config.yaml")
+}
+
+// Source is where the value of a flag came from.
+type Source string
+
+const (
+	SourceDefault  Source = "default"
+	SourceFlag     Source = "flag"
+	SourceEnv      Source = "env"
+	SourceFile     Source = "config file"
+	SourceDetected Source = "auto-detected"
+)
+
+// Origin is where the value of a flag came from. Name is the environment
+// variable or the path of the file, if any.
+type Origin struct {
+	Source Source
+	Name   string
+}
+
+func (o Origin) String() string {
+	if o.Name == "" {
+		return string(o.Source)
+	}
+	return fmt.Sprintf("%s %s", o.Source, o.Name)
+}
+
+// File is a config file.
+type File struct {
+	Path     string                            `yaml:"-"`
+	Profile  string                            `yaml:"profile"` // profile to use if none is selected
+	Profiles map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+// LoadFile reads the config file at path. It returns nil if there's none.
+func LoadFile(path string) (*File, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	f := &File{Path: path}
+	if err := yaml.UnmarshalStrict(b, f); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Config are the config files, ordered from lowest to highest precedence.
+type Config struct {
+	Files     []*File
+	LookupEnv func(string) (string, bool)
+}
+
+// Load reads the config file of the user in home and the project config file
+// in dir, each if it exists.
+func Load(home, dir string) (*Config, error) {
+	c := &Config{LookupEnv: os.LookupEnv}
+	paths := []string{filepath.Join(dir, ProjectFile)}
+	if home != "" {
+		paths = append([]string{UserFile(home)}, paths...)
+	}
+	for _, path := range paths {
+		f, err := LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			c.Files = append(c.Files, f)
+		}
+	}
+	return c, nil
+}
+
+// profile returns the name of the profile to use, empty for none.
+func (c *Config) profile(selected string) (string, error) {
+	if selected == "" {
+		for _, f := range c.Files {
+			if f.Profile != "" {
+				selected = f.Profile
+			}
+		}
+	}
+	if selected == "" {
+		for _, f := range c.Files {
+			if _, ok := f.Profiles[DefaultProfile]; ok {
+				return DefaultProfile, nil
+			}
+		}
+		return "", nil
+	}
+	for _, f := range c.Files {
+		if _, ok := f.Profiles[selected]; ok {
+			return selected, nil
+		}
+	}
+	paths := make([]string, len(c.Files))
+	for i, f := range c.Files {
+		paths[i] = f.Path
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("profile %s not found, no config file in %s or %s", selected, UserFile("~"), ProjectFile)
+	}
+	return "", fmt.Errorf("profile %s not found in %s", selected, strings.Join(paths, ", "))
+}
+
+type fileValue struct {
+	value interface{}
+	path  string
+}
+
+// Applied is the result of applying the config to flags.
+type Applied struct {
+	Profile string
+	Origins map[string]Origin // by flag name
+	Unused  []string          // options of the profile that aren't flags of the command
+}
+
+// Apply sets the flags that weren't given on the command line from their
+// environment variables, see BindEnv, or the selected profile, in that order
+// of precedence. With
+// profile empty, the profile set in the files or the default profile is used.
+func (c *Config) Apply(flags *pflag.FlagSet, profile string) (*Applied, error) {
+	if f := flags.Lookup(ProfileFlag); profile == "" && f != nil && !f.Changed {
+		_, profile, _ = c.lookupEnv(f)
+	}
+	profile, err := c.profile(profile)
+	if err != nil {
+		return nil, err
+	}
+	applied := &Applied{Profile: profile, Origins: map[string]Origin{}}
+
+	// Later files override earlier ones.
+	values := map[string]fileValue{}
+	if profile != "" {
+		for _, f := range c.Files {
+			options := map[string]interface{}{}
+			m, _ := normalize(f.Profiles[profile]).(map[string]interface{})
+			flatten("", m, flags, options)
+			for name, v := range options {
+				values[name] = fileValue{v, f.Path}
+			}
+		}
+	}
+	for name := range values {
+		if f := flags.Lookup(name); f == nil || f.Name == ProfileFlag {
+			applied.Unused = append(applied.Unused, name)
+			delete(values, name)
+		}
+	}
+	sort.Strings(applied.Unused)
+
+	var errs []error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			applied.Origins[f.Name] = Origin{Source: SourceFlag}
+			return
+		}
+		if name, v, ok := c.lookupEnv(f); ok {
+			if err := f.Value.Set(v); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value %q of %s for --%s: %w", v, name, f.Name, err))
+			}
+			applied.Origins[f.Name] = Origin{Source: SourceEnv, Name: name}
+			return
+		}
+		if fv, ok := values[f.Name]; ok {
+			if err := set(f, fv.value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value for %s in profile %s of %s: %w", f.Name, profile, fv.path, err))
+			}
+			applied.Origins[f.Name] = Origin{Source: SourceFile, Name: fv.path}
+			return
+		}
+		applied.Origins[f.Name] = Origin{Source: SourceDefault}
+	})
+	return applied, errors.Join(errs...)
+}
+
+// lookupEnv returns the first environment variable set to a non-empty value of
+// those bound to the flag.
+func (c *Config) lookupEnv(f *pflag.Flag) (string, string, bool) {
+	if c.LookupEnv == nil {
+		return "", "", false
+	}
+	for _, name := range EnvVars(f) {
+		if v, ok := c.LookupEnv(name); ok && v != "" {
+			return name, v, true
+		}
+	}
+	return "", "", false
+}
+
+// normalize turns the maps decoded by yaml into maps with string keys.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = normalize(e)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = normalize(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = normalize(e)
+		}
+		return l
+	}
+	return v
+}
+
+// flatten joins nested keys with dots, unless a key is a flag already, so
+// map values like --submission.env can be given as map.
+func flatten(prefix string, m map[string]interface{}, flags *pflag.FlagSet, out map[string]interface{}) {
+	for k, v := range m {
+		name := prefix + k
+		if nested, ok := v.(map[string]interface{}); ok && flags.Lookup(name) == nil {
+			flatten(name+".", nested, flags, out)
+			continue
+		}
+		out[name] = v
+	}
+}
+
+// set sets the flag to the value from a config file.
+func set(f *pflag.Flag, v interface{}) error {
+	switch v := v.(type) {
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, e := range v {
+			if m, ok := e.(map[string]interface{}); ok {
+				values[i] = pairs(m)
+				continue
+			}
+			values[i] = fmt.Sprint(e)
+		}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			return sv.Replace(values)
+		}
+		return f.Value.Set(strings.Join(values, ","))
+	case map[string]interface{}:
+		return f.Value.Set(pairs(v))
+	case nil:
+		return f.Value.Set("")
+	}
+	return f.Value.Set(fmt.Sprint(v))
+}
+
+// pairs formats m as comma separated key=value pairs, ordered by key.
+func pairs(m map[string]interface{}) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userConfig = `
+profile: dev
+profiles:
+  default:
+    env.scale: 2
+  dev:
+    env.scale: 4
+    env.image: user/engine:dev
+    engine:
+      render: true
+    env.mount:
+      - /a:/a
+      - /b:/b
+    submission.env:
+      FOO: bar
+      WORKERS: 1
+    agent.image: unknown
+  ci:
+    env.scale: 16
+`
+
+const projectConfig = `
+profiles:
+  dev:
+    env.image: project/engine:dev
+    path.roms: /project/roms
+    timeout.start: 1m
+`
+
+type testFlags struct {
+	scale   int
+	image   string
+	render  bool
+	mounts  []string
+	env     map[string]string
+	roms    string
+	timeout time.Duration
+	profile string
+	flagSet *pflag.FlagSet
+}
+
+func newTestFlags(t *testing.T, args ...string) *testFlags {
+	f := &testFlags{flagSet: pflag.NewFlagSet("test", pflag.ContinueOnError)}
+	f.flagSet.IntVar(&f.scale, "env.scale", 1, "")
+	f.flagSet.StringVar(&f.image, "env.image", "", "")
+	f.flagSet.BoolVar(&f.render, "engine.render", false, "")
+	f.flagSet.StringSliceVar(&f.mounts, "env.mount", []string{"/default:/default"}, "")
+	f.flagSet.StringToStringVar(&f.env, "submission.env", nil, "")
+	f.flagSet.StringVar(&f.roms, "path.roms", "/default/roms", "")
+	f.flagSet.DurationVar(&f.timeout, "timeout.start", 0, "")
+	f.flagSet.StringVar(&f.profile, ProfileFlag, "", "")
+	AddEnvAlias(f.flagSet, "path.roms", "DIAMBRAROMSPATH")
+	BindEnv(f.flagSet)
+	require.NoError(t, f.flagSet.Parse(args))
+	return f
+}
+
+func newTestConfig(t *testing.T, env map[string]string) *Config {
+	home, dir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Dir(UserFile(home)), 0755))
+	require.NoError(t, os.WriteFile(UserFile(home), []byte(userConfig), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ProjectFile), []byte(projectConfig), 0644))
+	c, err := Load(home, dir)
+	require.NoError(t, err)
+	require.Len(t, c.Files, 2)
+	c.LookupEnv = func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+	return c
+}
+
+func TestApply(t *testing.T) {
+	c := newTestConfig(t, map[string]string{"DIAMBRAROMSPATH": "/env/roms"})
+	f := newTestFlags(t, "--env.scale", "8")
+
+	applied, err := c.Apply(f.flagSet, "")
+	require.NoError(t, err)
+	assert.Equal(t, "dev", applied.Profile)
+	assert.Equal(t, []string{"agent.image"}, applied.Unused)
+
+	assert.Equal(t, 8, f.scale)
+	assert.Equal(t, "project/engine:dev", f.image)
+	assert.True(t, f.render)
+	assert.Equal(t, []string{"/a:/a", "/b:/b"}, f.mounts)
+	assert.Equal(t, map[string]string{"FOO": "bar", "WORKERS": "1"}, f.env)
+	assert.Equal(t, "/env/roms", f.roms)
+	assert.Equal(t, time.Minute, f.timeout)
+
+	assert.Equal(t, Origin{Source: SourceFlag}, applied.Origins["env.scale"])
+	assert.Equal(t, Origin{Source: SourceEnv, Name: "DIAMBRAROMSPATH"}, applied.Origins["path.roms"])
+	assert.Equal(t, Origin{Source: SourceFile, Name: c.Files[1].Path}, applied.Origins["env.image"])
+	assert.Equal(t, Origin{Source: SourceFile, Name: c.Files[0].Path}, applied.Origins["engine.render"])
+	assert.Equal(t, Origin{Source: SourceDefault}, applied.Origins[ProfileFlag])
+}
+
+func TestApplyEnv(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		profile string
+		scale   int
+		roms    string
+		mounts  []string
+		err     string
+	}{
+		{"none", nil, nil, "dev", 4, "/project/roms", []string{"/a:/a", "/b:/b"}, ""},
+		{"over file", map[string]string{"DIAMBRA_ENV_SCALE": "3", "DIAMBRA_ENV_MOUNT": "/c:/c,/d:/d"}, nil, "dev", 3, "/project/roms", []string{"/c:/c", "/d:/d"}, ""},
+		{"flag over env", map[string]string{"DIAMBRA_ENV_SCALE": "3"}, []string{"--env.scale", "5"}, "dev", 5, "/project/roms", []string{"/a:/a", "/b:/b"}, ""},
+		{"alias", map[string]string{"DIAMBRAROMSPATH": "/alias"}, nil, "dev", 4, "/alias", []string{"/a:/a", "/b:/b"}, ""},
+		{"derived over alias", map[string]string{"DIAMBRAROMSPATH": "/alias", "DIAMBRA_PATH_ROMS": "/derived"}, nil, "dev", 4, "/derived", []string{"/a:/a", "/b:/b"}, ""},
+		{"empty ignored", map[string]string{"DIAMBRA_ENV_SCALE": ""}, nil, "dev", 4, "/project/roms", []string{"/a:/a", "/b:/b"}, ""},
+		{"profile", map[string]string{"DIAMBRA_PROFILE": "ci"}, nil, "ci", 16, "/default/roms", []string{"/default:/default"}, ""},
+		{"invalid", map[string]string{"DIAMBRA_ENV_SCALE": "many"}, nil, "", 0, "", nil, `invalid value "many" of DIAMBRA_ENV_SCALE for --env.scale`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestConfig(t, tc.env)
+			f := newTestFlags(t, tc.args...)
+			applied, err := c.Apply(f.flagSet, "")
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.profile, applied.Profile)
+			assert.Equal(t, tc.scale, f.scale)
+			assert.Equal(t, tc.roms, f.roms)
+			assert.Equal(t, tc.mounts, f.mounts)
+		})
+	}
+}
+
+func TestBindEnv(t *testing.T) {
+	f := newTestFlags(t)
+	BindEnv(f.flagSet)
+	scale := f.flagSet.Lookup("env.scale")
+	assert.Equal(t, []string{"DIAMBRA_ENV_SCALE"}, EnvVars(scale))
+	assert.Equal(t, " (env $DIAMBRA_ENV_SCALE)", scale.Usage)
+	assert.Equal(t, []string{"DIAMBRA_PATH_ROMS", "DIAMBRAROMSPATH"}, EnvVars(f.flagSet.Lookup("path.roms")))
+	assert.Equal(t, "DIAMBRA_SUBMISSION_SECRETS_FROM", EnvVar("submission.secrets-from"))
+}
+
+func TestApplyProfile(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		profile  string
+		noFiles  bool
+		expected int // scale
+		err      string
+	}{
+		{"selected", "ci", false, 16, ""},
+		{"from file", "", false, 4, ""},
+		{"default", "default", false, 2, ""},
+		{"not found", "prod", false, 0, "profile prod not found in "},
+		{"no files", "", true, 1, ""},
+		{"no files selected", "prod", true, 0, "profile prod not found, no config file in "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestConfig(t, nil)
+			if tc.noFiles {
+				c.Files = nil
+			}
+			f := newTestFlags(t)
+			_, err := c.Apply(f.flagSet, tc.profile)
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, f.scale)
+		})
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	c := &Config{Files: []*File{{
+		Path:     "diambra.yaml",
+		Profiles: map[string]map[string]interface{}{"default": {"env.scale": "many"}},
+	}}}
+	_, err := c.Apply(newTestFlags(t).flagSet, "")
+	assert.ErrorContains(t, err, "invalid value for env.scale in profile default of diambra.yaml")
+}
+
+func TestLoadFileInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ProjectFile)
+	require.NoError(t, os.WriteFile(path, []byte("profils: {}\n"), 0644))
+	_, err := LoadFile(path)
+	assert.ErrorContains(t, err, "invalid config file "+path)
+
+	f, err := LoadFile(filepath.Join(t.TempDir(), ProjectFile))
+	assert.NoError(t, err)
+	assert.Nil(t, f)
+}
+
+func TestApplyListOfMaps(t *testing.T) {
+	c := &Config{Files: []*File{{
+		Path: "diambra.yaml",
+		Profiles: map[string]map[string]interface{}{"default": {"env.group": []interface{}{
+			map[interface{}]interface{}{"image": "a", "scale": 2},
+			map[interface{}]interface{}{"image": "b", "render": true},
+		}}},
+	}}}
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	groups := flags.StringSlice("env.group", nil, "")
+	_, err := c.Apply(flags, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"image=a,scale=2", "image=b,render=true"}, *groups)
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// EnvAnnotation is the flag annotation listing the environment variables
+// that set the flag, in order of precedence.
+const EnvAnnotation = "diambra_env"
+
+// SecretAnnotation marks flags with secret values, that must not be shown.
+const SecretAnnotation = "diambra_secret"
+
+// EnvPrefix is the prefix of the environment variables derived from flags.
+const EnvPrefix = "DIAMBRA_"
+
+var envReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// EnvVar returns the environment variable derived from the flag name, e.g
+// DIAMBRA_ENV_SCALE for env.scale.
+func EnvVar(name string) string {
+	return EnvPrefix + strings.ToUpper(envReplacer.Replace(name))
+}
+
+// BindEnv lets the environment variables derived from their names set all
+// flags of flags, and mentions the variable in their usage.
+func BindEnv(flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		name := EnvVar(f.Name)
+		names := EnvVars(f)
+		if slices.Contains(names, name) {
+			return
+		}
+		setEnvVars(f, append([]string{name}, names...))
+		f.Usage += " (env $" + name + ")"
+	})
+}
+
+// AddEnvAlias lets the environment variable alias set the flag name too, with
+// lower precedence than the variables bound so far.
+func AddEnvAlias(flags *pflag.FlagSet, name, alias string) {
+	f := flags.Lookup(name)
+	if f == nil {
+		return
+	}
+	setEnvVars(f, append(EnvVars(f), alias))
+}
+
+// EnvVars returns the environment variables that set the flag.
+func EnvVars(f *pflag.Flag) []string {
+	return f.Annotations[EnvAnnotation]
+}
+
+func setEnvVars(f *pflag.Flag, names []string) {
+	if f.Annotations == nil {
+		f.Annotations = map[string][]string{}
+	}
+	f.Annotations[EnvAnnotation] = names
+}
+
+// MarkSecret marks the flag name as holding secret values.
+func MarkSecret(flags *pflag.FlagSet, name string) {
+	flags.SetAnnotation(name, SecretAnnotation, []string{"true"}) //nolint:errcheck
+}
+
+// IsSecret returns whether the flag holds secret values.
+func IsSecret(f *pflag.Flag) bool {
+	_, ok := f.Annotations[SecretAnnotation]
+	return ok
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package container
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/pkg/archive"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+	"github.com/spf13/pflag"
+)
+
+const defaultDockerfile = "Dockerfile"
+
+// BuildOptions configures how an image gets built.
+type BuildOptions struct {
+	Dockerfile string   // path to the Dockerfile, defaults to Dockerfile in the build context
+	Target     string   // stage to build
+	Platform   string   // e.g linux/amd64
+	BuildArgs  []string // KEY=VALUE, or KEY to use the value from the environment
+	Labels     []string // KEY=VALUE
+	NoCache    bool
+}
+
+func (o *BuildOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&o.Dockerfile, "file", "f", "", "Path to the Dockerfile (default \"<path/to/agent>/Dockerfile\")")
+	flags.StringVar(&o.Target, "target", "", "Build stage to build")
+	flags.StringVar(&o.Platform, "platform", "", "Platform to build for, e.g linux/amd64")
+	flags.StringArrayVar(&o.BuildArgs, "build-arg", nil, "Build-time variable as KEY=VALUE, or KEY to take the value from the environment")
+	flags.StringArrayVar(&o.Labels, "label", nil, "Label to set on the image as KEY=VALUE")
+	flags.BoolVar(&o.NoCache, "no-cache", false, "Do not use cache when building the image")
+}
+
+// buildArgs returns the build args as expected by the docker API.
+func (o *BuildOptions) buildArgs() map[string]*string {
+	args := make(map[string]*string, len(o.BuildArgs))
+	for _, arg := range o.BuildArgs {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok {
+			ev, ok := os.LookupEnv(k)
+			if !ok {
+				// Like docker, omit args without value that aren't set in the environment.
+				continue
+			}
+			v = ev
+		}
+		args[k] = &v
+	}
+	return args
+}
+
+func (o *BuildOptions) labels() (map[string]string, error) {
+	labels := make(map[string]string, len(o.Labels))
+	for _, label := range o.Labels {
+		k, v, ok := strings.Cut(label, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label %s, must be KEY=VALUE", label)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+// dockerfile returns the path of the Dockerfile relative to the build context.
+func (o *BuildOptions) dockerfile(path string) (string, error) {
+	if o.Dockerfile == "" {
+		return defaultDockerfile, nil
+	}
+	abs, err := filepath.Abs(o.Dockerfile)
+	if err != nil {
+		return "", err
+	}
+	absContext, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absContext, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("dockerfile %s must be within the build context %s", o.Dockerfile, path)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// buildContext returns the build context for the directory at path as tar
+// stream, leaving out the files excluded by its .dockerignore.
+func buildContext(path, dockerfile string) (io.ReadCloser, error) {
+	excludes, err := readDockerignore(path, dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	return archive.TarWithOptions(path, &archive.TarOptions{ExcludePatterns: excludes})
+}
+
+// readDockerignore returns the exclude patterns for the build context. Like
+// docker, it prefers <Dockerfile>.dockerignore next to the Dockerfile over
+// .dockerignore in the context root, and never excludes the Dockerfile itself.
+func readDockerignore(path, dockerfile string) ([]string, error) {
+	f, err := os.Open(filepath.Join(path, filepath.FromSlash(dockerfile)+".dockerignore"))
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(path, ".dockerignore"))
+	}
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	excludes, err := ignorefile.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read .dockerignore: %w", err)
+	}
+	for _, keep := range []string{dockerfile, ".dockerignore"} {
+		if excluded, _ := patternmatcher.MatchesOrParentMatches(keep, excludes); excluded {
+			excludes = append(excludes, "!"+keep)
+		}
+	}
+	return excludes, nil
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package container
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func contextFiles(t *testing.T, path, dockerfile string) []string {
+	rc, err := buildContext(path, dockerfile)
+	require.NoError(t, err)
+	defer rc.Close()
+	files := []string{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			files = append(files, hdr.Name)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestBuildContext(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		files      map[string]string
+		dockerfile string
+		expected   []string
+	}{
+		{
+			name:       "no dockerignore",
+			files:      map[string]string{"Dockerfile": "", "agent.py": "", "checkpoints/model.zip": ""},
+			dockerfile: "Dockerfile",
+			expected:   []string{"Dockerfile", "agent.py", "checkpoints/model.zip"},
+		},
+		{
+			name:       "dockerignore",
+			files:      map[string]string{"Dockerfile": "", ".dockerignore": "checkpoints\n*.log\n", "agent.py": "", "checkpoints/model.zip": "", "train.log": ""},
+			dockerfile: "Dockerfile",
+			expected:   []string{".dockerignore", "Dockerfile", "agent.py"},
+		},
+		{
+			name:       "dockerfile excluded",
+			files:      map[string]string{"Dockerfile": "", ".dockerignore": "*\n!agent.py\n", "agent.py": "", "notes.txt": ""},
+			dockerfile: "Dockerfile",
+			expected:   []string{".dockerignore", "Dockerfile", "agent.py"},
+		},
+		{
+			name:       "dockerfile specific dockerignore",
+			files:      map[string]string{"docker/Dockerfile": "", "docker/Dockerfile.dockerignore": "agent.py\n", ".dockerignore": "notes.txt\n", "agent.py": "", "notes.txt": ""},
+			dockerfile: "docker/Dockerfile",
+			expected:   []string{".dockerignore", "docker/Dockerfile", "docker/Dockerfile.dockerignore", "notes.txt"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tc.files)
+			assert.Equal(t, tc.expected, contextFiles(t, dir, tc.dockerfile))
+		})
+	}
+}
+
+func TestBuildOptions(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("FROM_ENV", "env-value")
+	o := &BuildOptions{
+		BuildArgs: []string{"A=1", "EMPTY=", "FROM_ENV", "UNSET_BUILD_ARG"},
+		Labels:    []string{"org.example.team=rl", "empty="},
+	}
+
+	args := o.buildArgs()
+	require.Len(t, args, 3)
+	assert.Equal(t, "1", *args["A"])
+	assert.Equal(t, "", *args["EMPTY"])
+	assert.Equal(t, "env-value", *args["FROM_ENV"])
+
+	labels, err := o.labels()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"org.example.team": "rl", "empty": ""}, labels)
+	o.Labels = []string{"invalid"}
+	_, err = o.labels()
+	assert.Error(t, err)
+
+	dockerfile, err := o.dockerfile(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "Dockerfile", dockerfile)
+	o.Dockerfile = filepath.Join(dir, "docker", "Dockerfile.gpu")
+	dockerfile, err = o.dockerfile(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "docker/Dockerfile.gpu", dockerfile)
+	o.Dockerfile = filepath.Join(filepath.Dir(dir), "Dockerfile")
+	_, err = o.dockerfile(dir)
+	assert.Error(t, err)
+}
@@ -0,0 +1,729 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package containertest provides an in-memory container.Runner for tests.
+package containertest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diambra/cli/pkg/container"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Step identifies a Runner method, used to script failures.
+type Step string
+
+const (
+	StepPull      Step = "pull"
+	StepImage     Step = "image"
+	StepStart     Step = "start"
+	StepLogLogs   Step = "loglogs"
+	StepLogs      Step = "logs"
+	StepStop      Step = "stop"
+	StepTerminate Step = "terminate"
+	StepStopAll   Step = "stopall"
+	StepRemove    Step = "remove"
+	StepNetwork   Step = "network"
+	StepAttach    Step = "attach"
+	StepWait      Step = "wait"
+	StepBuild     Step = "build"
+	StepPush      Step = "push"
+	StepTagExists Step = "tagexists"
+	StepDigest    Step = "digest"
+	StepList      Step = "list"
+	StepStats     Step = "stats"
+)
+
+const (
+	// ExitCodeStopped is the exit code of containers stopped by Stop or
+	// StopAll, or killed by Terminate.
+	ExitCodeStopped = container.ExitCodeKilled
+	// ExitCodeTerminated is the exit code of containers that exited on the
+	// signal sent by Terminate.
+	ExitCodeTerminated = 143
+)
+
+// Behavior describes how containers started from an image behave.
+type Behavior struct {
+	// Output is streamed by Attach, LogLogs and Logs.
+	Output string
+	// Exit makes the container exit with ExitCode right after starting.
+	// Otherwise it runs until stopped.
+	Exit     bool
+	ExitCode int
+	// NotServing makes the health service of the container report it's not serving.
+	NotServing bool
+	// Stats are reported by Stats while the container is running.
+	Stats container.ContainerStats
+	// IgnoreStopSignal makes Terminate wait for the timeout and kill the container.
+	IgnoreStopSignal bool
+}
+
+// Container is a container simulated by Runner.
+type Container struct {
+	*container.Container
+	ID     string
+	Status *container.ContainerStatus
+
+	StartedAt time.Time
+
+	removed bool // guarded by Runner.mu
+
+	mu       sync.Mutex
+	behavior Behavior
+	stdin    bytes.Buffer
+	exitCode int
+	running  bool
+	done     chan struct{}
+	server   *grpc.Server
+}
+
+// Running returns whether the container hasn't exited yet.
+func (c *Container) Running() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running
+}
+
+// ExitCode returns the exit code of an exited container.
+func (c *Container) ExitCode() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.exitCode
+}
+
+// Stdin returns everything written to the container's stdin so far.
+func (c *Container) Stdin() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stdin.String()
+}
+
+// Exit makes a running container exit with the given code.
+func (c *Container) Exit(code int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.running {
+		return
+	}
+	c.running = false
+	c.exitCode = code
+	close(c.done)
+	if c.server != nil {
+		c.server.Stop()
+	}
+}
+
+// Endpoint returns the local host:port the given container port is reachable at.
+func (c *Container) Endpoint(port string) string {
+	addr, ok := (*c.Status.PortMapping)[container.Port(port)]
+	if !ok {
+		return ""
+	}
+	return "127.0.0.1:" + string(addr.Port)
+}
+
+func (c *Container) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stdin.Write(p)
+}
+
+func (c *Container) Close() error {
+	return nil
+}
+
+var _ container.Runner = &Runner{}
+
+// Runner implements container.Runner without running anything. Running
+// containers publishing ports get a gRPC server with the health service
+// listening on them on 127.0.0.1 instead, so they look like ready envs. Ports
+// already in use are left alone, unless by another container, in which case
+// Start fails like docker does.
+type Runner struct {
+	// Behaviors by container name or image. Containers without behavior run
+	// until stopped and don't produce any output.
+	Behaviors map[string]Behavior
+
+	// Tags known to exist in the registry, used by TagExists and Digest.
+	Tags map[string]bool
+
+	// Images available locally, used by ImageExists. Pulled and built
+	// images get added.
+	Images map[string]bool
+
+	// AutoRemove hides exited containers from List.
+	AutoRemove bool
+
+	mu         sync.Mutex
+	containers []*Container
+	pulled     []string
+	built      map[string]string
+	pushed     []string
+	calls      map[Step]int
+	failures   map[Step]map[int]error
+	networks   map[string]map[string]string
+}
+
+func NewRunner() *Runner {
+	return &Runner{
+		Behaviors: map[string]Behavior{},
+		Tags:      map[string]bool{},
+		Images:    map[string]bool{},
+		built:     map[string]string{},
+		calls:     map[Step]int{},
+		failures:  map[Step]map[int]error{},
+		networks:  map[string]map[string]string{},
+	}
+}
+
+// FailAt makes the n-th call (starting at 1) of the given step return err.
+// If n is 0, every call fails.
+func (r *Runner) FailAt(step Step, n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures[step] == nil {
+		r.failures[step] = map[int]error{}
+	}
+	r.failures[step][n] = err
+}
+
+// Calls returns how often the given step was called.
+func (r *Runner) Calls(step Step) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[step]
+}
+
+// Containers returns all containers started, in order.
+func (r *Runner) Containers() []*Container {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Container{}, r.containers...)
+}
+
+// Running returns all containers that didn't exit yet.
+func (r *Runner) Running() []*Container {
+	running := []*Container{}
+	for _, c := range r.Containers() {
+		if c.Running() {
+			running = append(running, c)
+		}
+	}
+	return running
+}
+
+// Networks returns the names of the networks that weren't removed yet.
+func (r *Runner) Networks() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.networks))
+	for name := range r.networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Pulled returns the images pulled, in order.
+func (r *Runner) Pulled() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.pulled...)
+}
+
+// Built returns the build context path of every tag built.
+func (r *Runner) Built() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	built := make(map[string]string, len(r.built))
+	for k, v := range r.built {
+		built[k] = v
+	}
+	return built
+}
+
+// Pushed returns the tags pushed, in order.
+func (r *Runner) Pushed() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.pushed...)
+}
+
+// call records a call of step and returns the scripted error for it, if any.
+// Must be called with r.mu held.
+func (r *Runner) call(step Step) error {
+	r.calls[step]++
+	if err, ok := r.failures[step][r.calls[step]]; ok {
+		return err
+	}
+	return r.failures[step][0]
+}
+
+// exists returns whether the container wasn't removed yet.
+// Must be called with r.mu held.
+func (r *Runner) exists(c *Container) bool {
+	return !c.removed && (c.Running() || !r.AutoRemove)
+}
+
+// portAllocated returns whether a running container publishes the host port.
+// Must be called with r.mu held.
+func (r *Runner) portAllocated(port string) bool {
+	for _, c := range r.containers {
+		if !c.Running() {
+			continue
+		}
+		for _, addr := range *c.Status.PortMapping {
+			if string(addr.Port) == port {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *Runner) container(id string) (*Container, error) {
+	for _, c := range r.containers {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("no such container: %s", id)
+}
+
+func (r *Runner) Pull(ctx context.Context, c *container.Container, output *os.File) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepPull); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.pulled = append(r.pulled, c.Image)
+	r.Images[c.Image] = true
+	return nil
+}
+
+func (r *Runner) ImageExists(ctx context.Context, image string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepImage); err != nil {
+		return false, err
+	}
+	return r.Images[image], nil
+}
+
+func (r *Runner) Start(ctx context.Context, c *container.Container) (*container.ContainerStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepStart); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := r.networks[c.Network]; c.Network != "" && !ok {
+		return nil, fmt.Errorf("network %s not found", c.Network)
+	}
+	if c.Name != "" {
+		for _, other := range r.containers {
+			if other.Name == c.Name && r.exists(other) {
+				return nil, fmt.Errorf("conflict: container name %s is already in use by %s", c.Name, other.ID)
+			}
+		}
+	}
+
+	n := len(r.containers)
+	behavior, ok := r.Behaviors[c.Name]
+	if !ok {
+		behavior = r.Behaviors[c.Image]
+	}
+	pm := container.PortMapping{}
+	listeners := []net.Listener{}
+	if c.PortMapping != nil {
+		for cp, ha := range *c.PortMapping {
+			host, port := ha.Host, string(ha.Port)
+			if host == "" {
+				host = "0.0.0.0"
+			}
+			if port != "" && port != "0" && r.portAllocated(port) {
+				for _, lis := range listeners {
+					lis.Close()
+				}
+				return nil, fmt.Errorf("Bind for %s:%s failed: port is already allocated", host, port)
+			}
+			if port == "" || port == "0" {
+				lis, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					return nil, err
+				}
+				listeners = append(listeners, lis)
+				port = fmt.Sprintf("%d", lis.Addr().(*net.TCPAddr).Port)
+			} else if lis, err := net.Listen("tcp", "127.0.0.1:"+port); err == nil {
+				listeners = append(listeners, lis)
+			}
+			pm.AddPortMapping(string(cp), port, host)
+		}
+	}
+	fc := &Container{
+		Container: c,
+		ID:        fmt.Sprintf("container-%d", n),
+		Status: &container.ContainerStatus{
+			ID:          fmt.Sprintf("container-%d", n),
+			PortMapping: &pm,
+			Address:     fmt.Sprintf("172.17.0.%d", n+2),
+		},
+		StartedAt: time.Now(),
+		behavior:  behavior,
+		running:   true,
+		done:      make(chan struct{}),
+	}
+	r.containers = append(r.containers, fc)
+	if behavior.Exit {
+		for _, lis := range listeners {
+			lis.Close()
+		}
+		fc.Exit(behavior.ExitCode)
+		return fc.Status, nil
+	}
+	if len(listeners) > 0 {
+		fc.server = grpc.NewServer()
+		hs := health.NewServer()
+		if behavior.NotServing {
+			hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		}
+		healthpb.RegisterHealthServer(fc.server, hs)
+		for _, lis := range listeners {
+			go fc.server.Serve(lis) //nolint:errcheck
+		}
+	}
+	return fc.Status, nil
+}
+
+// LogLogs logs the output of the container. The output counts as written when
+// the container started, so it's skipped if since is later.
+func (r *Runner) LogLogs(ctx context.Context, id string, since time.Time, logger log.Logger) error {
+	r.mu.Lock()
+	err := r.call(StepLogLogs)
+	c, cerr := r.container(id)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if cerr != nil {
+		return cerr
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(c.behavior.Output, "\n"), "\n") {
+		if line != "" && (since.IsZero() || !since.After(c.StartedAt)) {
+			level.Info(logger).Log("msg", line)
+		}
+	}
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Logs writes the output of the container to w. Since is ignored.
+func (r *Runner) Logs(ctx context.Context, id string, opts container.LogsOptions, w io.Writer) error {
+	r.mu.Lock()
+	err := r.call(StepLogs)
+	c, cerr := r.container(id)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if cerr != nil {
+		return cerr
+	}
+	if _, err := io.WriteString(w, c.behavior.Output); err != nil {
+		return err
+	}
+	if !opts.Follow {
+		return nil
+	}
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Runner) Stop(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepStop); err != nil {
+		return err
+	}
+	c, err := r.container(id)
+	if err != nil {
+		return err
+	}
+	c.Exit(ExitCodeStopped)
+	return nil
+}
+
+func (r *Runner) Terminate(ctx context.Context, id string, opts container.StopOptions) (bool, error) {
+	r.mu.Lock()
+	err := r.call(StepTerminate)
+	c, cerr := r.container(id)
+	r.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+	if cerr != nil {
+		return false, cerr
+	}
+	if !c.Running() {
+		return false, nil
+	}
+	sig := strings.TrimPrefix(strings.ToUpper(opts.Signal), "SIG")
+	if sig == "KILL" || sig == "9" {
+		c.Exit(ExitCodeStopped)
+		return false, nil
+	}
+	if !c.behavior.IgnoreStopSignal {
+		c.Exit(ExitCodeTerminated)
+		return false, nil
+	}
+	select {
+	case <-c.done:
+		return false, nil
+	case <-time.After(opts.Timeout):
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+	c.Exit(ExitCodeStopped)
+	return true, nil
+}
+
+func (r *Runner) Remove(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepRemove); err != nil {
+		return err
+	}
+	c, err := r.container(id)
+	if err != nil {
+		return nil
+	}
+	c.Exit(ExitCodeStopped)
+	c.removed = true
+	return nil
+}
+
+func (r *Runner) StopAll(ctx context.Context, session string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepStopAll); err != nil {
+		return err
+	}
+	for _, c := range r.containers {
+		if session != "" && c.Labels[container.LabelSession] != session {
+			continue
+		}
+		c.Exit(ExitCodeStopped)
+		c.removed = true
+	}
+	for name, labels := range r.networks {
+		if session == "" || labels[container.LabelSession] == session {
+			delete(r.networks, name)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) CreateNetwork(ctx context.Context, name string, labels map[string]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepNetwork); err != nil {
+		return err
+	}
+	if _, ok := r.networks[name]; !ok {
+		r.networks[name] = labels
+	}
+	return nil
+}
+
+func (r *Runner) RemoveNetwork(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.containers {
+		if c.Network == name && c.Running() {
+			return fmt.Errorf("network %s has active endpoints", name)
+		}
+	}
+	delete(r.networks, name)
+	return nil
+}
+
+func (r *Runner) Attach(ctx context.Context, id string) (io.WriteCloser, io.ReadCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepAttach); err != nil {
+		return nil, nil, err
+	}
+	c, err := r.container(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		if _, err := io.WriteString(pw, c.behavior.Output); err != nil {
+			return
+		}
+		<-c.done
+		pw.Close()
+	}()
+	return c, pr, nil
+}
+
+func (r *Runner) Wait(ctx context.Context, id string) (int, error) {
+	r.mu.Lock()
+	err := r.call(StepWait)
+	c, cerr := r.container(id)
+	r.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if cerr != nil {
+		return 0, cerr
+	}
+	select {
+	case <-c.done:
+		return c.ExitCode(), nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (r *Runner) Build(ctx context.Context, path, tag string, opts container.BuildOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepBuild); err != nil {
+		return err
+	}
+	r.built[tag] = path
+	r.Images[tag] = true
+	return nil
+}
+
+func (r *Runner) Login(username, password, registry string) {}
+
+func (r *Runner) Push(ctx context.Context, tag string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepPush); err != nil {
+		return err
+	}
+	r.pushed = append(r.pushed, tag)
+	r.Tags[tag] = true
+	return nil
+}
+
+func (r *Runner) TagExists(ctx context.Context, tag string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepTagExists); err != nil {
+		return false, err
+	}
+	return r.Tags[tag], nil
+}
+
+// Digest returns a digest derived from the tag for tags in the registry.
+func (r *Runner) Digest(ctx context.Context, tag string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepDigest); err != nil {
+		return "", err
+	}
+	if !r.Tags[tag] {
+		return "", fmt.Errorf("manifest unknown: %s", tag)
+	}
+	return Digest(tag), nil
+}
+
+// Digest returns the digest the Runner reports for tag.
+func Digest(tag string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(tag)))
+}
+
+func (r *Runner) List(ctx context.Context, session string) ([]*container.ContainerInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepList); err != nil {
+		return nil, err
+	}
+	infos := []*container.ContainerInfo{}
+	for _, c := range r.containers {
+		if !r.exists(c) || (session != "" && c.Labels[container.LabelSession] != session) {
+			continue
+		}
+		state := "running"
+		if !c.Running() {
+			state = "exited"
+		}
+		restarts, _ := strconv.Atoi(c.Labels[container.LabelRestarts])
+		infos = append(infos, &container.ContainerInfo{
+			ContainerStatus: *c.Status,
+			Name:            c.Name,
+			Image:           c.Image,
+			Labels:          c.Labels,
+			State:           state,
+			StartedAt:       c.StartedAt,
+			AutoRemove:      r.AutoRemove,
+			Restarts:        restarts,
+		})
+	}
+	return infos, nil
+}
+
+func (r *Runner) Stats(ctx context.Context, id string) (*container.ContainerStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call(StepStats); err != nil {
+		return nil, err
+	}
+	c, err := r.container(id)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Running() {
+		return nil, fmt.Errorf("container %s is not running", id)
+	}
+	stats := c.behavior.Stats
+	return &stats, nil
+}
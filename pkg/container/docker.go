@@ -23,7 +23,6 @@ import (
 	"io"
 	"os"
 	"runtime"
-	"strconv"
 	"strings"
 	"time"
 
@@ -31,9 +30,10 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/errdefs"
-	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/go-connections/nat"
 	"github.com/go-kit/log"
@@ -41,13 +41,18 @@ import (
 	"github.com/moby/term"
 )
 
+// ConnectTimeout bounds checking the connection to the container runtime, so
+// an unresponsive socket doesn't hang the cli.
+const ConnectTimeout = 10 * time.Second
+
 // DockerRunner implements Runner
 type DockerRunner struct {
 	log.Logger
 	*client.Client
 	TimeoutStop  time.Duration
 	AutoRemove   bool
-	registryAuth string
+	logins       map[string]string // encoded credentials by registry, set by Login
+	dockerConfig *DockerConfig     // loaded on first use
 }
 
 func NewDockerRunner(logger log.Logger, autoRemove bool) (*DockerRunner, error) {
@@ -56,22 +61,42 @@ func NewDockerRunner(logger log.Logger, autoRemove bool) (*DockerRunner, error)
 		level.Error(logger).Log("msg", "failed to create docker client", "err", err.Error())
 		os.Exit(1)
 	}
-	_, err = cl.Ping(context.TODO())
+	ctx, cancel := context.WithTimeout(context.Background(), ConnectTimeout)
+	defer cancel()
+	_, err = cl.Ping(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't connect to docker. Make sure your user has docker access: %w", err)
 	}
+	return newDockerRunner(logger, cl, autoRemove), nil
+}
+
+func newDockerRunner(logger log.Logger, cl *client.Client, autoRemove bool) *DockerRunner {
 	return &DockerRunner{
 		Logger:      logger,
 		Client:      cl,
 		TimeoutStop: 10 * time.Second,
 		AutoRemove:  autoRemove,
-	}, nil
+	}
+}
+
+// ImageExists returns whether the image is available locally.
+func (r *DockerRunner) ImageExists(ctx context.Context, image string) (bool, error) {
+	_, _, err := r.Client.ImageInspectWithRaw(ctx, image)
+	if err == nil {
+		return true, nil
+	}
+	if errdefs.IsNotFound(err) {
+		return false, nil
+	}
+	return false, err
 }
 
-func (r *DockerRunner) Pull(c *Container, output *os.File) error {
-	reader, err := r.Client.ImagePull(context.TODO(), c.Image, types.ImagePullOptions{})
+func (r *DockerRunner) Pull(ctx context.Context, c *Container, output *os.File) error {
+	reader, err := r.Client.ImagePull(ctx, c.Image, types.ImagePullOptions{
+		RegistryAuth: r.registryAuth(c.Image),
+	})
 	if err != nil {
-		return fmt.Errorf("couldn't pull image %s: %w:\nTo disable pulling the image on start, retry with --images.no-pull", c.Image, err)
+		return fmt.Errorf("couldn't pull image %s: %w:\nTo use a local image instead, retry with --images.pull missing", c.Image, err)
 	}
 	defer reader.Close()
 
@@ -79,9 +104,19 @@ func (r *DockerRunner) Pull(c *Container, output *os.File) error {
 	return jsonmessage.DisplayJSONMessagesStream(reader, io.Writer(output), termFd, isTerm, nil)
 }
 
-func (r *DockerRunner) Start(c *Container) (*ContainerStatus, error) {
+func (r *DockerRunner) Start(ctx context.Context, c *Container) (*ContainerStatus, error) {
+	config, hostConfig, err := r.containerConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return r.run(ctx, c, config, hostConfig)
+}
+
+// containerConfig translates a Container into the docker API configs. It's
+// shared with other runners talking the docker API, so they can adjust the
+// result before calling run.
+func (r *DockerRunner) containerConfig(c *Container) (*container.Config, *container.HostConfig, error) {
 	var (
-		ctx    = context.Background()
 		config = &container.Config{
 			Image:     c.Image,
 			Hostname:  c.Hostname,
@@ -92,17 +127,37 @@ func (r *DockerRunner) Start(c *Container) (*ContainerStatus, error) {
 			Labels: map[string]string{
 				"diambra": "env",
 			},
-			StopSignal: "SIGKILL", // FIXME: Make diambraApp handle SIGTERM insteads
-			WorkingDir: c.WorkingDir,
-			Cmd:        c.Args,
-			Entrypoint: c.Command,
+			StopSignal:  c.StopSignal,
+			StopTimeout: ptr(int(r.TimeoutStop.Seconds())),
+			WorkingDir:  c.WorkingDir,
+			Cmd:         c.Args,
+			Entrypoint:  c.Command,
 		}
 		hostConfig = &container.HostConfig{
 			AutoRemove:  r.AutoRemove,
 			SecurityOpt: c.SecurityOpt,
 			IpcMode:     container.IpcMode(c.IPCMode),
+			Resources: container.Resources{
+				Memory:   c.MemoryLimitBytes,
+				NanoCPUs: int64(c.CPULimitCores * 1e9),
+			},
 		}
 	)
+	if config.StopSignal == "" {
+		// Don't wait for containers that might not handle any other signal.
+		config.StopSignal = "SIGKILL"
+	}
+	if c.StopTimeout > 0 {
+		config.StopTimeout = ptr(int(c.StopTimeout.Seconds()))
+	}
+	if c.MemoryLimitBytes > 0 {
+		// Disable swap, so exceeding the limit gets the container OOM-killed
+		// like it would in evaluation.
+		hostConfig.Resources.MemorySwap = c.MemoryLimitBytes
+	}
+	for k, v := range c.Labels {
+		config.Labels[k] = v
+	}
 	hostConfig.Mounts = make([]mount.Mount, len(c.BindMounts))
 
 	if c.PortMapping != nil {
@@ -125,7 +180,7 @@ func (r *DockerRunner) Start(c *Container) (*ContainerStatus, error) {
 	}
 	if c.Sound {
 		if runtime.GOOS == "windows" {
-			return nil, fmt.Errorf("sound is not supported on windows")
+			return nil, nil, fmt.Errorf("sound is not supported on windows")
 		}
 		level.Debug(r.Logger).Log("msg", "enabling sound")
 		hostConfig.Devices = append(hostConfig.Devices, container.DeviceMapping{
@@ -136,7 +191,7 @@ func (r *DockerRunner) Start(c *Container) (*ContainerStatus, error) {
 
 		agid, err := getGID("/dev/snd/seq")
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		hostConfig.GroupAdd = []string{fmt.Sprintf("%d", agid)}
 		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
@@ -151,8 +206,21 @@ func (r *DockerRunner) Start(c *Container) (*ContainerStatus, error) {
 			ReadOnly: true,
 		})
 	}
-	level.Debug(r.Logger).Log("msg", "creating container", "config", fmt.Sprintf("%#v", config), "hostConfig", fmt.Sprintf("%#v", hostConfig))
-	dc, err := r.Client.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	return config, hostConfig, nil
+}
+
+func (r *DockerRunner) run(ctx context.Context, c *Container, config *container.Config, hostConfig *container.HostConfig) (*ContainerStatus, error) {
+	level.Debug(r.Logger).Log("msg", "creating container", "name", c.Name, "config", fmt.Sprintf("%#v", config), "hostConfig", fmt.Sprintf("%#v", hostConfig))
+	var networkingConfig *network.NetworkingConfig
+	if c.Network != "" {
+		hostConfig.NetworkMode = container.NetworkMode(c.Network)
+		networkingConfig = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				c.Network: {Aliases: c.NetworkAliases},
+			},
+		}
+	}
+	dc, err := r.Client.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, c.Name)
 	if err != nil {
 		return nil, err
 	}
@@ -165,11 +233,83 @@ func (r *DockerRunner) Start(c *Container) (*ContainerStatus, error) {
 		return nil, err
 	}
 	level.Debug(r.Logger).Log("msg", "container running")
+	return containerStatus(cj), nil
+}
+
+func containerStatus(cj types.ContainerJSON) *ContainerStatus {
 	portMapping := make(PortMapping, len(cj.NetworkSettings.Ports))
 	for p, pbs := range cj.NetworkSettings.Ports {
+		if len(pbs) == 0 {
+			continue
+		}
 		portMapping.AddPortMapping(string(p), string(pbs[0].HostPort), pbs[0].HostIP)
 	}
-	return &ContainerStatus{ID: dc.ID, PortMapping: &portMapping, Address: cj.NetworkSettings.IPAddress}, nil
+	address := cj.NetworkSettings.IPAddress
+	if n, ok := cj.NetworkSettings.Networks[string(cj.HostConfig.NetworkMode)]; ok && address == "" {
+		address = n.IPAddress
+	}
+	return &ContainerStatus{ID: cj.ID, PortMapping: &portMapping, Address: address}
+}
+
+// CreateNetwork creates a bridge network with the given name, unless it already exists.
+func (r *DockerRunner) CreateNetwork(ctx context.Context, name string, labels map[string]string) error {
+	if _, err := r.Client.NetworkInspect(ctx, name, types.NetworkInspectOptions{}); err == nil {
+		return nil
+	} else if !errdefs.IsNotFound(err) {
+		return err
+	}
+	networkLabels := map[string]string{"diambra": "env"}
+	for k, v := range labels {
+		networkLabels[k] = v
+	}
+	_, err := r.Client.NetworkCreate(ctx, name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Labels:         networkLabels,
+	})
+	return err
+}
+
+func (r *DockerRunner) RemoveNetwork(ctx context.Context, name string) error {
+	err := r.Client.NetworkRemove(ctx, name)
+	if errdefs.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// List returns all containers started by the runner in the given session, or
+// all sessions if empty, including exited ones that weren't removed yet.
+func (r *DockerRunner) List(ctx context.Context, session string) ([]*ContainerInfo, error) {
+	containers, err := r.Client.ContainerList(ctx, types.ContainerListOptions{Filters: labelFilters(session), All: true})
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*ContainerInfo, 0, len(containers))
+	for _, c := range containers {
+		cj, err := r.Client.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				// Removed in the meantime
+				continue
+			}
+			return nil, err
+		}
+		info := &ContainerInfo{
+			ContainerStatus: *containerStatus(cj),
+			Name:            strings.TrimPrefix(cj.Name, "/"),
+			Image:           cj.Config.Image,
+			Labels:          cj.Config.Labels,
+			State:           cj.State.Status,
+			AutoRemove:      cj.HostConfig.AutoRemove,
+			Restarts:        cj.RestartCount + restarts(cj.Config.Labels),
+		}
+		if info.StartedAt, err = time.Parse(time.RFC3339Nano, cj.State.StartedAt); err != nil {
+			level.Debug(r.Logger).Log("msg", "couldn't parse start time", "id", c.ID, "startedAt", cj.State.StartedAt, "err", err)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
 }
 
 type logWriter struct {
@@ -181,13 +321,15 @@ func (l *logWriter) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-func (r *DockerRunner) LogLogs(id string, logger log.Logger) error {
-	ctx := context.TODO()
-	out, err := r.Client.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+func (r *DockerRunner) LogLogs(ctx context.Context, id string, since time.Time, logger log.Logger) error {
+	opts := types.ContainerLogsOptions{
 		ShowStdout: true,
 		Follow:     true,
-		Since:      strconv.Itoa(int(time.Now().Unix())),
-	})
+	}
+	if !since.IsZero() {
+		opts.Since = fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())
+	}
+	out, err := r.Client.ContainerLogs(ctx, id, opts)
 	if err != nil {
 		return err
 	}
@@ -199,15 +341,68 @@ func (r *DockerRunner) LogLogs(id string, logger log.Logger) error {
 	//_, err = stdcopy.StdCopy(os.Stdout, os.Stderr, out)
 }
 
+// Logs copies the output of the container to w. Containers run with a tty, so
+// the output isn't multiplexed.
+func (r *DockerRunner) Logs(ctx context.Context, id string, opts LogsOptions, w io.Writer) error {
+	out, err := r.Client.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Since:      opts.Since,
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(w, out)
+	return err
+}
+
 func ptr[T any](t T) *T {
 	return &t
 }
 
-func (r *DockerRunner) Stop(id string) error {
-	ctx := context.TODO()
-	return r.Client.ContainerStop(ctx, id, container.StopOptions{
-		Timeout: ptr(int(r.TimeoutStop.Seconds())),
-	})
+// Stop stops the container with its stop signal, killing it after its stop timeout.
+func (r *DockerRunner) Stop(ctx context.Context, id string) error {
+	return r.Client.ContainerStop(ctx, id, container.StopOptions{})
+}
+
+func (r *DockerRunner) Terminate(ctx context.Context, id string, opts StopOptions) (bool, error) {
+	// Wait before stopping, so the exit status doesn't get lost if the
+	// container gets removed right away.
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	statusCh, errCh := r.Client.ContainerWait(waitCtx, id, container.WaitConditionNotRunning)
+
+	if err := r.Client.ContainerStop(ctx, id, container.StopOptions{
+		Signal:  opts.Signal,
+		Timeout: ptr(int(opts.Timeout.Seconds())),
+	}); err != nil {
+		if errdefs.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	select {
+	case status := <-statusCh:
+		return status.StatusCode == ExitCodeKilled && !killSignal(opts.Signal), nil
+	case err := <-errCh:
+		if errdefs.IsNotFound(err) {
+			// Removed before we got the status, so it's unknown whether it got killed.
+			return false, nil
+		}
+		return false, err
+	}
+}
+
+// Remove removes the container, killing it if it's still running.
+// Containers that are already gone or getting removed are ignored.
+func (r *DockerRunner) Remove(ctx context.Context, id string) error {
+	err := r.Client.ContainerRemove(ctx, id, types.ContainerRemoveOptions{RemoveVolumes: true, Force: true})
+	if errdefs.IsNotFound(err) || errdefs.IsConflict(err) {
+		return nil
+	}
+	return err
 }
 
 type HijackedResponseReader struct {
@@ -226,8 +421,7 @@ func (r *HijackedResponseReader) Close() error {
 	return nil
 }
 
-func (r *DockerRunner) Attach(id string) (io.WriteCloser, io.ReadCloser, error) {
-	ctx := context.TODO()
+func (r *DockerRunner) Attach(ctx context.Context, id string) (io.WriteCloser, io.ReadCloser, error) {
 	resp, err := r.Client.ContainerAttach(ctx, id, types.ContainerAttachOptions{
 		Stream: true,
 		Stdin:  true,
@@ -242,8 +436,7 @@ func (r *DockerRunner) Attach(id string) (io.WriteCloser, io.ReadCloser, error)
 	return resp.Conn, &HijackedResponseReader{log.With(r.Logger, "in", "HijackedResponseReader"), resp}, nil
 }
 
-func (r *DockerRunner) Wait(id string) (int, error) {
-	ctx := context.TODO()
+func (r *DockerRunner) Wait(ctx context.Context, id string) (int, error) {
 	statusCh, errCh := r.Client.ContainerWait(ctx, id, container.WaitConditionNotRunning)
 
 	var (
@@ -264,26 +457,36 @@ func (r *DockerRunner) Wait(id string) (int, error) {
 	return statusCode, err
 }
 
-func (r *DockerRunner) StopAll() error {
+func labelFilters(session string) filters.Args {
 	filters := filters.NewArgs()
 	filters.Add("label", "diambra=env")
-	ctx := context.TODO()
-	containers, err := r.Client.ContainerList(ctx, types.ContainerListOptions{Filters: filters})
+	if session != "" {
+		filters.Add("label", LabelSession+"="+session)
+	}
+	return filters
+}
+
+func (r *DockerRunner) StopAll(ctx context.Context, session string) error {
+	containers, err := r.Client.ContainerList(ctx, types.ContainerListOptions{Filters: labelFilters(session), All: true})
 	if err != nil {
 		return err
 	}
 	if len(containers) == 0 {
 		level.Info(r.Logger).Log("msg", "no containers to stop")
-		os.Exit(0)
 	}
 	for _, c := range containers {
-		level.Info(r.Logger).Log("msg", "stopping container", "id", c.ID)
-		if err := r.Stop(c.ID); err != nil {
-			return err
+		if c.State == "running" {
+			level.Info(r.Logger).Log("msg", "stopping container", "id", c.ID, "session", c.Labels[LabelSession])
+			if err := r.Stop(ctx, c.ID); err != nil {
+				return err
+			}
 		}
 
 		ci, err := r.Client.ContainerInspect(ctx, c.ID)
 		if err != nil {
+			if errdefs.IsNotFound(err) {
+				continue
+			}
 			return err
 		}
 		if ci.HostConfig.AutoRemove {
@@ -293,19 +496,42 @@ func (r *DockerRunner) StopAll() error {
 			return err
 		}
 	}
+
+	networks, err := r.Client.NetworkList(ctx, types.NetworkListOptions{Filters: labelFilters(session)})
+	if err != nil {
+		return err
+	}
+	for _, n := range networks {
+		level.Debug(r.Logger).Log("msg", "removing network", "name", n.Name)
+		if err := r.RemoveNetwork(ctx, n.ID); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (r *DockerRunner) Build(path string, tag string) error {
-	ctx := context.Background()
-
-	context, err := archive.TarWithOptions(path, &archive.TarOptions{})
+func (r *DockerRunner) Build(ctx context.Context, path string, tag string, opts BuildOptions) error {
+	dockerfile, err := opts.dockerfile(path)
+	if err != nil {
+		return err
+	}
+	labels, err := opts.labels()
 	if err != nil {
 		return err
 	}
-	defer context.Close()
-	resp, err := r.Client.ImageBuild(ctx, context, types.ImageBuildOptions{
-		Tags: []string{tag},
+	buildContext, err := buildContext(path, dockerfile)
+	if err != nil {
+		return err
+	}
+	defer buildContext.Close()
+	resp, err := r.Client.ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+		Tags:       []string{tag},
+		Dockerfile: dockerfile,
+		Target:     opts.Target,
+		Platform:   opts.Platform,
+		BuildArgs:  opts.buildArgs(),
+		Labels:     labels,
+		NoCache:    opts.NoCache,
 	})
 	if err != nil {
 		return err
@@ -334,13 +560,54 @@ func (r *DockerRunner) Login(username, password, serverAddress string) {
 		panic(err)
 	}
 
-	r.registryAuth = base64.URLEncoding.EncodeToString(authStr)
+	if r.logins == nil {
+		r.logins = map[string]string{}
+	}
+	r.logins[serverAddress] = base64.URLEncoding.EncodeToString(authStr)
+}
+
+// registryAuth returns the encoded credentials for the registry hosting the
+// image. Credentials set by Login take precedence over the docker CLI config.
+// Problems with the docker CLI config are logged and result in anonymous access.
+func (r *DockerRunner) registryAuth(image string) string {
+	reg, err := RegistryFor(image)
+	if err != nil {
+		level.Warn(r.Logger).Log("msg", "couldn't determine registry", "image", image, "err", err.Error())
+		return ""
+	}
+	if auth, ok := r.logins[reg]; ok {
+		return auth
+	}
+	if r.dockerConfig == nil {
+		path, err := DockerConfigPath()
+		if err == nil {
+			r.dockerConfig, err = LoadDockerConfig(path)
+		}
+		if err != nil {
+			level.Warn(r.Logger).Log("msg", "couldn't load docker config", "err", err.Error())
+			r.dockerConfig = &DockerConfig{}
+		}
+	}
+	ac, err := r.dockerConfig.AuthConfig(reg)
+	if err != nil {
+		level.Warn(r.Logger).Log("msg", "couldn't get registry credentials", "registry", reg, "err", err.Error())
+		return ""
+	}
+	if ac == nil {
+		return ""
+	}
+	auth, err := registry.EncodeAuthConfig(*ac)
+	if err != nil {
+		level.Warn(r.Logger).Log("msg", "couldn't encode registry credentials", "registry", reg, "err", err.Error())
+		return ""
+	}
+	level.Debug(r.Logger).Log("msg", "using registry credentials", "registry", reg)
+	return auth
 }
 
-func (r *DockerRunner) Push(tag string) error {
-	ctx := context.Background()
+func (r *DockerRunner) Push(ctx context.Context, tag string) error {
 	resp, err := r.Client.ImagePush(ctx, tag, types.ImagePushOptions{
-		RegistryAuth: r.registryAuth,
+		RegistryAuth: r.registryAuth(tag),
 	})
 	if err != nil {
 		return err
@@ -351,9 +618,17 @@ func (r *DockerRunner) Push(tag string) error {
 	return jsonmessage.DisplayJSONMessagesStream(resp, io.Writer(os.Stderr), termFd, isTerm, nil)
 }
 
-func (r *DockerRunner) TagExists(tag string) (bool, error) {
-	ctx := context.Background()
-	_, err := r.Client.DistributionInspect(ctx, tag, r.registryAuth)
+// Digest returns the digest of the image the tag points to in the registry.
+func (r *DockerRunner) Digest(ctx context.Context, tag string) (string, error) {
+	inspect, err := r.Client.DistributionInspect(ctx, tag, r.registryAuth(tag))
+	if err != nil {
+		return "", err
+	}
+	return inspect.Descriptor.Digest.String(), nil
+}
+
+func (r *DockerRunner) TagExists(ctx context.Context, tag string) (bool, error) {
+	_, err := r.Client.DistributionInspect(ctx, tag, r.registryAuth(tag))
 	if err == nil {
 		return true, nil
 	}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// PodmanRunner implements Runner by talking to the docker compatible API
+// served by podman. It only differs from DockerRunner in how containers are
+// created, to make rootless podman work with the bind mounts and users we use.
+type PodmanRunner struct {
+	*DockerRunner
+	Rootless bool
+}
+
+func NewPodmanRunner(logger log.Logger, autoRemove bool) (*PodmanRunner, error) {
+	cl, err := client.NewClientWithOpts(client.FromEnv, client.WithHost(podmanHost()), client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create podman client: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ConnectTimeout)
+	defer cancel()
+	info, err := cl.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect to podman. Make sure the podman socket is running (systemctl --user start podman.socket): %w", err)
+	}
+	rootless := false
+	for _, opt := range info.SecurityOptions {
+		if opt == "name=rootless" {
+			rootless = true
+		}
+	}
+	level.Debug(logger).Log("msg", "connected to podman", "host", cl.DaemonHost(), "rootless", rootless)
+	return &PodmanRunner{
+		DockerRunner: newDockerRunner(logger, cl, autoRemove),
+		Rootless:     rootless,
+	}, nil
+}
+
+// podmanHost returns the podman API socket, preferring CONTAINER_HOST which is
+// what the podman cli uses, then the rootless and rootful default sockets.
+func podmanHost() string {
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return host
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" && os.Geteuid() != 0 {
+		return "unix://" + filepath.Join(dir, "podman", "podman.sock")
+	}
+	return "unix:///run/podman/podman.sock"
+}
+
+func (r *PodmanRunner) Start(ctx context.Context, c *Container) (*ContainerStatus, error) {
+	config, hostConfig, err := r.containerConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Rootless {
+		// In rootless podman, the host user is mapped to root in the container
+		// and every other uid to a subordinate uid. Map the host user to the
+		// requested user instead, so bind mounted files owned by the host user,
+		// like the credentials, stay accessible.
+		userns, err := keepIDUserNS(c.User)
+		if err != nil {
+			return nil, err
+		}
+		hostConfig.UsernsMode = userns
+		if c.Sound {
+			// The host audio group can't be added to a rootless container
+			// directly, but podman can preserve the supplementary groups.
+			hostConfig.GroupAdd = []string{"keep-groups"}
+		}
+	}
+	if relabelMounts(hostConfig) {
+		level.Debug(r.Logger).Log("msg", "disabling SELinux separation, container mounts system paths", "name", c.Name)
+	}
+	return r.run(ctx, c, config, hostConfig)
+}
+
+// selinuxSystemPaths are host paths mounted for rendering and sound, that
+// must not get relabeled.
+var selinuxSystemPaths = []string{"/dev", "/etc", "/run", "/tmp/.X11-unix", "/usr"}
+
+// relabelMounts makes the bind mounts accessible with SELinux by relabeling
+// them as content shared between containers. System paths can't be relabeled,
+// so SELinux separation gets disabled for containers mounting them instead,
+// which it returns.
+func relabelMounts(hostConfig *container.HostConfig) bool {
+	for _, m := range hostConfig.Mounts {
+		if m.Type == mount.TypeBind && isSystemPath(m.Source) {
+			hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "label=disable")
+			return true
+		}
+	}
+	mounts := []mount.Mount{}
+	for _, m := range hostConfig.Mounts {
+		if m.Type != mount.TypeBind {
+			mounts = append(mounts, m)
+			continue
+		}
+		// The mounts API can't relabel, but binds can.
+		opts := "z"
+		if m.ReadOnly {
+			opts = "ro,z"
+		}
+		hostConfig.Binds = append(hostConfig.Binds, m.Source+":"+m.Target+":"+opts)
+	}
+	hostConfig.Mounts = mounts
+	return false
+}
+
+func isSystemPath(path string) bool {
+	path = filepath.Clean(path)
+	for _, p := range selinuxSystemPaths {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// keepIDUserNS returns the podman user namespace mode mapping the host user
+// to the given "uid[:gid]" in the container.
+func keepIDUserNS(user string) (container.UsernsMode, error) {
+	if user == "" {
+		return "keep-id", nil
+	}
+	uid, gid, _ := strings.Cut(user, ":")
+	if gid == "" {
+		gid = uid
+	}
+	for _, id := range []string{uid, gid} {
+		if _, err := strconv.Atoi(id); err != nil {
+			return "", fmt.Errorf("user %s must be numeric for rootless podman: %w", user, err)
+		}
+	}
+	return container.UsernsMode(fmt.Sprintf("keep-id:uid=%s,gid=%s", uid, gid)), nil
+}
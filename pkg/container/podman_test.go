@@ -0,0 +1,96 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package container
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepIDUserNS(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		user     string
+		expected container.UsernsMode
+		err      bool
+	}{
+		{"empty", "", "keep-id", false},
+		{"uid", "1000", "keep-id:uid=1000,gid=1000", false},
+		{"uid and gid", "1000:100", "keep-id:uid=1000,gid=100", false},
+		{"name", "root", "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			userns, err := keepIDUserNS(tc.user)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, userns)
+		})
+	}
+}
+
+func TestRelabelMounts(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		mounts   []mount.Mount
+		disabled bool
+		binds    []string
+	}{
+		{"none", nil, false, nil},
+		{
+			"user paths",
+			[]mount.Mount{
+				{Type: mount.TypeBind, Source: "/home/user/roms", Target: "/opt/diambraArena/roms"},
+				{Type: mount.TypeBind, Source: "/home/user/.diambra/credentials", Target: "/tmp/.diambra/credentials", ReadOnly: true},
+			},
+			false,
+			[]string{"/home/user/roms:/opt/diambraArena/roms:z", "/home/user/.diambra/credentials:/tmp/.diambra/credentials:ro,z"},
+		},
+		{
+			"system paths",
+			[]mount.Mount{
+				{Type: mount.TypeBind, Source: "/home/user/roms", Target: "/opt/diambraArena/roms"},
+				{Type: mount.TypeBind, Source: "/tmp/.X11-unix", Target: "/tmp/.X11-unix"},
+			},
+			true,
+			nil,
+		},
+		{
+			"similar prefix",
+			[]mount.Mount{{Type: mount.TypeBind, Source: "/usrdata", Target: "/data"}},
+			false,
+			[]string{"/usrdata:/data:z"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hostConfig := &container.HostConfig{Mounts: tc.mounts}
+			assert.Equal(t, tc.disabled, relabelMounts(hostConfig))
+			assert.Equal(t, tc.binds, hostConfig.Binds)
+			if tc.disabled {
+				assert.Equal(t, []string{"label=disable"}, hostConfig.SecurityOpt)
+				assert.Equal(t, tc.mounts, hostConfig.Mounts)
+			} else {
+				assert.Empty(t, hostConfig.SecurityOpt)
+				assert.Empty(t, hostConfig.Mounts)
+			}
+		})
+	}
+}
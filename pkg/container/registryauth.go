@@ -0,0 +1,181 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package container
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+)
+
+// dockerHubRegistry is the key Docker Hub credentials are stored under.
+const dockerHubRegistry = "https://index.docker.io/v1/"
+
+// errCredentialsNotFound is what credential helpers print if they don't
+// have credentials for a registry.
+const errCredentialsNotFound = "credentials not found in native keychain"
+
+// DockerConfig is the part of the docker CLI config.json holding registry credentials.
+type DockerConfig struct {
+	Auths       map[string]DockerConfigAuth `json:"auths"`
+	CredsStore  string                      `json:"credsStore"`
+	CredHelpers map[string]string           `json:"credHelpers"`
+}
+
+type DockerConfigAuth struct {
+	Auth          string `json:"auth"` // base64 encoded username:password
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// DockerConfigPath returns the path of the docker CLI config.json, honoring $DOCKER_CONFIG.
+func DockerConfigPath() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".docker", "config.json"), nil
+}
+
+// LoadDockerConfig reads the docker CLI config at path. A missing file results in an empty config.
+func LoadDockerConfig(path string) (*DockerConfig, error) {
+	config := &DockerConfig{}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, config); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// RegistryFor returns the registry hosting the given image, as used as key
+// in the docker CLI config.
+func RegistryFor(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %s: %w", image, err)
+	}
+	domain := reference.Domain(named)
+	if domain == "docker.io" {
+		return dockerHubRegistry, nil
+	}
+	return domain, nil
+}
+
+// AuthConfig resolves the credentials for the registry like the docker CLI
+// does: A registry specific credential helper takes precedence over the
+// credentials store, which takes precedence over the credentials in auths.
+// If there are no credentials, it returns nil.
+func (c *DockerConfig) AuthConfig(reg string) (*registry.AuthConfig, error) {
+	helper := c.CredHelpers[reg]
+	if helper == "" {
+		helper = c.CredsStore
+	}
+	if helper != "" {
+		ac, err := credentialHelper(helper, reg)
+		if err != nil || ac != nil {
+			return ac, err
+		}
+	}
+
+	for key, auth := range c.Auths {
+		if normalizeRegistry(key) != normalizeRegistry(reg) {
+			continue
+		}
+		ac := &registry.AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			IdentityToken: auth.IdentityToken,
+			ServerAddress: reg,
+		}
+		if auth.Auth != "" {
+			b, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth for %s: %w", key, err)
+			}
+			var ok bool
+			if ac.Username, ac.Password, ok = strings.Cut(string(b), ":"); !ok {
+				return nil, fmt.Errorf("invalid auth for %s: expected username:password", key)
+			}
+		}
+		return ac, nil
+	}
+	return nil, nil
+}
+
+// normalizeRegistry strips the scheme and path from the registry keys used in auths.
+func normalizeRegistry(reg string) string {
+	if reg == dockerHubRegistry {
+		return reg
+	}
+	reg = strings.TrimPrefix(strings.TrimPrefix(reg, "https://"), "http://")
+	host, _, _ := strings.Cut(reg, "/")
+	return host
+}
+
+// credentialHelper gets the credentials for the registry from
+// docker-credential-<helper>. If the helper has none, it returns nil.
+func credentialHelper(helper, reg string) (*registry.AuthConfig, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(reg)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stdout.String(), errCredentialsNotFound) {
+			return nil, nil
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to run %v: %w: %s", cmd, err, strings.TrimSpace(stdout.String()))
+		}
+		return nil, fmt.Errorf("failed to run %v: %w", cmd, err)
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return nil, fmt.Errorf("couldn't parse output of %v: %w", cmd, err)
+	}
+	ac := &registry.AuthConfig{ServerAddress: reg}
+	// Helpers return identity tokens with this magic username.
+	if creds.Username == "<token>" {
+		ac.IdentityToken = creds.Secret
+	} else {
+		ac.Username = creds.Username
+		ac.Password = creds.Secret
+	}
+	return ac, nil
+}
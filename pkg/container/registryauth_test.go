@@ -0,0 +1,126 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/docker/docker/api/types/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryFor(t *testing.T) {
+	for image, expected := range map[string]string{
+		"diambra/engine:latest":                     dockerHubRegistry,
+		"ubuntu":                                    dockerHubRegistry,
+		"registry.diambra.ai/user/agent:v1":         "registry.diambra.ai",
+		"localhost:5000/agent@sha256:" + testDigest: "localhost:5000",
+	} {
+		reg, err := RegistryFor(image)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, reg, image)
+	}
+	_, err := RegistryFor("Invalid Image")
+	assert.Error(t, err)
+}
+
+const testDigest = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// fakeCredentialHelper installs a docker-credential-fake helper in PATH,
+// which knows credentials for ghcr.io only.
+func fakeCredentialHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	dir := t.TempDir()
+	script := `#!/bin/sh
+read registry
+if [ "$registry" = "ghcr.io" ]; then
+  echo '{"ServerURL": "ghcr.io", "Username": "helper-user", "Secret": "helper-secret"}'
+  exit 0
+fi
+echo "credentials not found in native keychain"
+exit 1
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestDockerConfigAuthConfig(t *testing.T) {
+	fakeCredentialHelper(t)
+	for _, tc := range []struct {
+		name     string
+		config   string
+		registry string
+		expected *registry.AuthConfig
+	}{
+		{
+			name:     "no config",
+			config:   `{}`,
+			registry: "ghcr.io",
+		},
+		{
+			name:     "auths",
+			config:   `{"auths": {"https://registry.example.com/v2/": {"auth": "dXNlcjpwYXNz"}}}`,
+			registry: "registry.example.com",
+			expected: &registry.AuthConfig{Username: "user", Password: "pass", ServerAddress: "registry.example.com"},
+		},
+		{
+			name:     "docker hub",
+			config:   `{"auths": {"https://index.docker.io/v1/": {"username": "user", "password": "pass"}}}`,
+			registry: dockerHubRegistry,
+			expected: &registry.AuthConfig{Username: "user", Password: "pass", ServerAddress: dockerHubRegistry},
+		},
+		{
+			name:     "creds store",
+			config:   `{"credsStore": "fake", "auths": {"ghcr.io": {}}}`,
+			registry: "ghcr.io",
+			expected: &registry.AuthConfig{Username: "helper-user", Password: "helper-secret", ServerAddress: "ghcr.io"},
+		},
+		{
+			name:     "cred helper takes precedence",
+			config:   `{"credHelpers": {"ghcr.io": "fake"}, "auths": {"ghcr.io": {"auth": "dXNlcjpwYXNz"}}}`,
+			registry: "ghcr.io",
+			expected: &registry.AuthConfig{Username: "helper-user", Password: "helper-secret", ServerAddress: "ghcr.io"},
+		},
+		{
+			name:     "helper without credentials falls back to auths",
+			config:   `{"credsStore": "fake", "auths": {"registry.example.com": {"auth": "dXNlcjpwYXNz"}}}`,
+			registry: "registry.example.com",
+			expected: &registry.AuthConfig{Username: "user", Password: "pass", ServerAddress: "registry.example.com"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			require.NoError(t, os.WriteFile(path, []byte(tc.config), 0600))
+			config, err := LoadDockerConfig(path)
+			require.NoError(t, err)
+			ac, err := config.AuthConfig(tc.registry)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, ac)
+		})
+	}
+}
+
+func TestDockerConfigMissingHelper(t *testing.T) {
+	config := &DockerConfig{CredsStore: "does-not-exist"}
+	_, err := config.AuthConfig("ghcr.io")
+	assert.Error(t, err)
+}
@@ -16,12 +16,14 @@
 package container
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-kit/log"
 )
@@ -83,6 +85,16 @@ func (pm *PortMapping) AddPortMapping(containerPort string, hostPort string, hos
 	(*pm)[Port(containerPort)] = Address{Host: hostAddress, Port: Port(hostPort)}
 }
 
+const (
+	// LabelSession is the label holding the arena session a container belongs to.
+	LabelSession = "diambra.session"
+	// LabelEnv is the label holding the index of an env container in its session.
+	LabelEnv = "diambra.env"
+	// LabelRestarts is the label holding how often an env got replaced by a
+	// new container after exiting.
+	LabelRestarts = "diambra.restarts"
+)
+
 type Container struct {
 	Name             string
 	Image            string
@@ -99,6 +111,11 @@ type Container struct {
 	WorkingDir       string
 	IPCMode          string
 	Sound            bool
+	Labels           map[string]string
+	Network          string        // network to attach to instead of the default one
+	NetworkAliases   []string      // names of the container on Network
+	StopSignal       string        // signal to stop the container with, SIGKILL if empty
+	StopTimeout      time.Duration // time to wait after StopSignal before killing the container
 
 	// If true, the entrypoint of the image will be overridden. Only used for
 	// `diambra agent test`.
@@ -111,17 +128,113 @@ type ContainerStatus struct {
 	Address     string
 }
 
+// ContainerInfo describes a container started by a Runner, running or not.
+type ContainerInfo struct {
+	ContainerStatus
+	Name       string
+	Image      string
+	Labels     map[string]string
+	State      string // e.g running or exited
+	StartedAt  time.Time
+	AutoRemove bool
+	Restarts   int // restarts by the runtime and replacements of exited envs
+}
+
+// LogsOptions selects the output returned by Runner.Logs.
+type LogsOptions struct {
+	Follow bool   // keep streaming new output until the container exits
+	Since  string // timestamp or duration relative to now, e.g 10m. Empty for all output
+}
+
+// restarts returns the number of restarts recorded in the labels.
+func restarts(labels map[string]string) int {
+	n, err := strconv.Atoi(labels[LabelRestarts])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// StopOptions configure how Runner.Terminate stops a container.
+type StopOptions struct {
+	Signal  string        // e.g SIGTERM
+	Timeout time.Duration // time to wait after Signal before killing the container
+}
+
+// killSignal returns whether the signal kills the container right away.
+func killSignal(signal string) bool {
+	switch strings.TrimPrefix(strings.ToUpper(signal), "SIG") {
+	case "KILL", "9":
+		return true
+	}
+	return false
+}
+
+// ExitCodeKilled is the exit code of containers killed by SIGKILL.
+const ExitCodeKilled = 137
+
 type Runner interface {
-	Pull(*Container, *os.File) error
-	Start(*Container) (*ContainerStatus, error)
-	LogLogs(id string, logger log.Logger) error
-	Stop(id string) error
-	StopAll() error
-	Attach(id string) (io.WriteCloser, io.ReadCloser, error)
-	Wait(id string) (int, error)
-	Build(path, tag string) error
+	Pull(ctx context.Context, c *Container, output *os.File) error
+	ImageExists(ctx context.Context, image string) (bool, error)
+	Start(ctx context.Context, c *Container) (*ContainerStatus, error)
+	// LogLogs logs the output of the container since the given time, all of
+	// it if zero, until the container exits.
+	LogLogs(ctx context.Context, id string, since time.Time, logger log.Logger) error
+	Logs(ctx context.Context, id string, opts LogsOptions, w io.Writer) error
+	Stop(ctx context.Context, id string) error
+	// Terminate stops the container with the signal given and kills it if it
+	// doesn't exit within the timeout. It returns whether it got killed.
+	Terminate(ctx context.Context, id string, opts StopOptions) (bool, error)
+	Remove(ctx context.Context, id string) error
+	CreateNetwork(ctx context.Context, name string, labels map[string]string) error
+	RemoveNetwork(ctx context.Context, name string) error
+	StopAll(ctx context.Context, session string) error
+	Attach(ctx context.Context, id string) (io.WriteCloser, io.ReadCloser, error)
+	Wait(ctx context.Context, id string) (int, error)
+	Build(ctx context.Context, path, tag string, opts BuildOptions) error
 	Login(username, password, registry string)
-	Push(tag string) error
+	Push(ctx context.Context, tag string) error
+	TagExists(ctx context.Context, tag string) (bool, error)
+	Digest(ctx context.Context, tag string) (string, error)
+	List(ctx context.Context, session string) ([]*ContainerInfo, error)
+	Stats(ctx context.Context, id string) (*ContainerStats, error)
+}
+
+// Runtime is the container runtime used to run containers. It implements
+// pflag.Value so it can be used as flag directly.
+type Runtime string
+
+const (
+	RuntimeDocker Runtime = "docker"
+	RuntimePodman Runtime = "podman"
+)
+
+func (r *Runtime) String() string {
+	return string(*r)
+}
+
+func (r *Runtime) Set(s string) error {
+	switch Runtime(s) {
+	case RuntimeDocker, RuntimePodman:
+		*r = Runtime(s)
+		return nil
+	}
+	return fmt.Errorf("invalid runtime %s, must be one of %s, %s", s, RuntimeDocker, RuntimePodman)
+}
+
+func (r *Runtime) Type() string {
+	return "runtime"
+}
+
+// NewRunner returns the Runner for the given runtime.
+func NewRunner(logger log.Logger, runtime Runtime, autoRemove bool) (Runner, error) {
+	switch runtime {
+	case RuntimeDocker, "":
+		return NewDockerRunner(logger, autoRemove)
+	case RuntimePodman:
+		return NewPodmanRunner(logger, autoRemove)
+	}
+	return nil, fmt.Errorf("unsupported runtime %s", runtime)
 }
 
 func TagFromDir(dir string) (string, error) {
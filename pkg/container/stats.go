@@ -0,0 +1,92 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/docker/docker/api/types"
+)
+
+// ContainerStats is a snapshot of the resource usage of a running container.
+type ContainerStats struct {
+	CPUPercent  float64 // 100% per fully used CPU
+	MemoryUsage uint64  // bytes, excluding the page cache
+	MemoryLimit uint64  // bytes
+	NetworkRx   uint64  // bytes received on all interfaces
+	NetworkTx   uint64  // bytes sent on all interfaces
+}
+
+// MemoryPercent returns the memory usage relative to the limit.
+func (s *ContainerStats) MemoryPercent() float64 {
+	if s.MemoryLimit == 0 {
+		return 0
+	}
+	return float64(s.MemoryUsage) / float64(s.MemoryLimit) * 100
+}
+
+// Stats returns the resource usage of the container. The CPU usage is
+// measured over the sampling period of the runtime, so this takes a moment.
+func (r *DockerRunner) Stats(ctx context.Context, id string) (*ContainerStats, error) {
+	resp, err := r.Client.ContainerStats(ctx, id, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var v types.StatsJSON
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, err
+	}
+	return statsFromJSON(&v), nil
+}
+
+// statsFromJSON calculates the stats the same way the docker CLI does.
+func statsFromJSON(v *types.StatsJSON) *ContainerStats {
+	s := &ContainerStats{
+		MemoryLimit: v.MemoryStats.Limit,
+		MemoryUsage: v.MemoryStats.Usage,
+	}
+
+	var (
+		cpuDelta    = float64(v.CPUStats.CPUUsage.TotalUsage) - float64(v.PreCPUStats.CPUUsage.TotalUsage)
+		systemDelta = float64(v.CPUStats.SystemUsage) - float64(v.PreCPUStats.SystemUsage)
+		onlineCPUs  = float64(v.CPUStats.OnlineCPUs)
+	)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(v.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if systemDelta > 0 && cpuDelta > 0 {
+		s.CPUPercent = cpuDelta / systemDelta * onlineCPUs * 100
+	}
+
+	// The page cache can be reclaimed, so it doesn't count as used. It's
+	// called total_inactive_file on cgroup v1 and inactive_file on v2.
+	for _, key := range []string{"total_inactive_file", "inactive_file"} {
+		if cache, ok := v.MemoryStats.Stats[key]; ok {
+			if cache < s.MemoryUsage {
+				s.MemoryUsage -= cache
+			}
+			break
+		}
+	}
+
+	for _, n := range v.Networks {
+		s.NetworkRx += n.RxBytes
+		s.NetworkTx += n.TxBytes
+	}
+	return s
+}
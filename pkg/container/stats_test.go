@@ -0,0 +1,80 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package container
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsFromJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		json string
+		want ContainerStats
+	}{
+		{
+			name: "cgroup v2",
+			json: `{
+				"cpu_stats": {"cpu_usage": {"total_usage": 3000}, "system_cpu_usage": 20000, "online_cpus": 4},
+				"precpu_stats": {"cpu_usage": {"total_usage": 1000}, "system_cpu_usage": 10000},
+				"memory_stats": {"usage": 1000, "limit": 4000, "stats": {"inactive_file": 200}},
+				"networks": {"eth0": {"rx_bytes": 10, "tx_bytes": 20}, "eth1": {"rx_bytes": 1, "tx_bytes": 2}}
+			}`,
+			want: ContainerStats{CPUPercent: 80, MemoryUsage: 800, MemoryLimit: 4000, NetworkRx: 11, NetworkTx: 22},
+		},
+		{
+			name: "cgroup v1 without online cpus",
+			json: `{
+				"cpu_stats": {"cpu_usage": {"total_usage": 2000, "percpu_usage": [1000, 1000]}, "system_cpu_usage": 20000},
+				"precpu_stats": {"cpu_usage": {"total_usage": 1000}, "system_cpu_usage": 10000},
+				"memory_stats": {"usage": 1000, "limit": 2000, "stats": {"total_inactive_file": 500}}
+			}`,
+			want: ContainerStats{CPUPercent: 20, MemoryUsage: 500, MemoryLimit: 2000},
+		},
+		{
+			name: "first sample",
+			json: `{
+				"cpu_stats": {"cpu_usage": {"total_usage": 2000}, "system_cpu_usage": 20000, "online_cpus": 1},
+				"memory_stats": {"usage": 100, "limit": 2000, "stats": {"inactive_file": 500}}
+			}`,
+			want: ContainerStats{CPUPercent: 10, MemoryUsage: 100, MemoryLimit: 2000},
+		},
+		{
+			name: "not running",
+			json: `{}`,
+			want: ContainerStats{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var v types.StatsJSON
+			require.NoError(t, json.Unmarshal([]byte(tc.json), &v))
+			got := statsFromJSON(&v)
+			assert.InDelta(t, tc.want.CPUPercent, got.CPUPercent, 0.001)
+			got.CPUPercent = tc.want.CPUPercent
+			assert.Equal(t, tc.want, *got)
+		})
+	}
+}
+
+func TestMemoryPercent(t *testing.T) {
+	assert.Equal(t, 25.0, (&ContainerStats{MemoryUsage: 1, MemoryLimit: 4}).MemoryPercent())
+	assert.Equal(t, 0.0, (&ContainerStats{MemoryUsage: 1}).MemoryPercent())
+}
@@ -18,17 +18,23 @@ package diambra
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/diambra/cli/pkg/config"
 	"github.com/diambra/cli/pkg/container"
 	"github.com/diambra/cli/pkg/diambra/client"
 	"github.com/diambra/cli/pkg/secretsources"
 	"github.com/diambra/init/initializer"
+	"github.com/docker/go-units"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/spf13/pflag"
@@ -45,6 +51,7 @@ type AppArgs struct {
 	Render     bool
 	LockFPS    bool
 	Sound      bool
+	Extra      map[string]string // additional engine flags, empty values for switches
 }
 
 type Args []string
@@ -68,18 +75,83 @@ func (a AppArgs) Args() []string {
 	args.Bool("--lockFps", a.LockFPS)
 	args.Bool("--sound", a.Sound)
 	args.Int("--randomSeed", a.RandomSeed)
+
+	keys := make([]string, 0, len(a.Extra))
+	for k := range a.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--"+engineArgName(k))
+		if v := a.Extra[k]; v != "" {
+			args = append(args, v)
+		}
+	}
 	return args
 }
 
+// Timeouts for the individual steps of running DIAMBRA arena. Zero disables the timeout.
+type Timeouts struct {
+	Pull  time.Duration // pulling a single image
+	Start time.Duration // starting an env until it's ready
+	Ready time.Duration // waiting for a started env to serve requests
+	Agent time.Duration // running the agent until it exits
+}
+
+// DefaultReadyTimeout bounds how long to wait for an env to get ready.
+const DefaultReadyTimeout = 2 * time.Minute
+
+// Resources limits the resources available to a container. Zero values mean unlimited.
+type Resources struct {
+	Memory string // e.g 512m or 4g
+	CPUs   float64
+}
+
+func (r Resources) Apply(c *container.Container) error {
+	if r.Memory != "" {
+		memory, err := units.RAMInBytes(r.Memory)
+		if err != nil {
+			return fmt.Errorf("invalid memory limit %s: %w", r.Memory, err)
+		}
+		c.MemoryLimitBytes = memory
+	}
+	if r.CPUs < 0 {
+		return fmt.Errorf("invalid cpu limit %v", r.CPUs)
+	}
+	c.CPULimitCores = r.CPUs
+	return nil
+}
+
+// LogFiles configures writing the output of each container to its own file.
+type LogFiles struct {
+	Dir      string // empty disables log files
+	MaxSize  string // size after which files get rotated, e.g 10m
+	MaxFiles int    // number of rotated files to keep
+}
+
+// maxSize returns MaxSize in bytes, 0 meaning no rotation.
+func (l LogFiles) maxSize() (int64, error) {
+	if l.MaxSize == "" || l.MaxSize == "0" {
+		return 0, nil
+	}
+	size, err := units.RAMInBytes(l.MaxSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid log file size %s: %w", l.MaxSize, err)
+	}
+	return size, nil
+}
+
 type EnvConfig struct {
 	logger log.Logger
 
 	AppArgs AppArgs
 
 	Scale       int
+	Groups      EnvGroups // replace Scale if set
 	AutoRemove  bool
 	AgentImage  string
-	NoPullImage bool
+	NoPullImage bool // deprecated, same as PullPolicy never
+	PullPolicy  PullPolicy
 
 	RomsPath string
 	CredPath string
@@ -98,11 +170,47 @@ type EnvConfig struct {
 	Mounts   []*container.BindMount
 	mounts   []string
 
-	PreallocatePort bool
+	PreallocatePort  bool
+	StartParallelism int           // number of envs to start at once
+	StopSignal       string        // signal to stop envs with
+	StopTimeout      time.Duration // time for envs to exit after StopSignal before getting killed
+	Ports            PortRange     // host ports to publish envs on, random if unset
 
 	InitImage string
+
+	Timeouts Timeouts
+
+	EnvResources   Resources
+	AgentResources Resources // defaults to the values set before calling AddFlags
+
+	Session       string
+	AttachSession string // use the envs of this recorded session instead of starting any
+	SessionsDir   string // where sessions get recorded, empty to not record them
+	Restart       RestartPolicy
+
+	LogFiles LogFiles
+
+	Seed     int            // base of the env seeds, 0 for random seeds
+	EnvSeeds map[string]int // seeds pinned by env index
+	envSeeds map[int]int
 }
 
+var (
+	sessionRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	signalRegexp  = regexp.MustCompile(`^(SIG[A-Z0-9+-]+|[0-9]+)$`)
+)
+
+const (
+	// DefaultStopSignal is the signal envs get stopped with. The engine
+	// doesn't handle SIGTERM yet, so they get killed right away instead of
+	// waiting for the stop timeout every time.
+	DefaultStopSignal = "SIGKILL"
+	// DefaultStopTimeout is how long envs get to exit after the stop signal.
+	DefaultStopTimeout = 10 * time.Second
+	// DefaultStartParallelism is the number of envs started at once.
+	DefaultStartParallelism = 4
+)
+
 func NewConfig(logger log.Logger) (*EnvConfig, error) {
 	userName := ""
 	if runtime.GOOS != "windows" {
@@ -121,11 +229,12 @@ func NewConfig(logger log.Logger) (*EnvConfig, error) {
 		return nil, fmt.Errorf("couldn't get hostname: %w", err)
 	}
 	return &EnvConfig{
-		logger:   logger,
-		User:     userName,
-		Home:     homedir,
-		Hostname: hostname,
-		Output:   os.Stderr,
+		logger:      logger,
+		User:        userName,
+		Home:        homedir,
+		Hostname:    hostname,
+		Output:      os.Stderr,
+		SessionsDir: SessionsDir(homedir),
 	}, nil
 }
 
@@ -135,9 +244,22 @@ func (c *EnvConfig) AddRomsPathFlag(flags *pflag.FlagSet) {
 		defaultRomsPath = filepath.Join(c.Home, ".diambra", "roms")
 	}
 	flags.StringVarP(&c.RomsPath, "path.roms", "r", defaultRomsPath, "Path to ROMs (default to DIAMBRAROMSPATH env var if set)")
+	config.AddEnvAlias(flags, "path.roms", "DIAMBRAROMSPATH")
+}
+
+// AddAttachSessionFlag adds the flag to use the envs of a running session.
+// Only for commands that don't leave envs running.
+func (c *EnvConfig) AddAttachSessionFlag(flags *pflag.FlagSet) {
+	flags.StringVar(&c.AttachSession, "attach-session", "", "Use the envs of this running session, e.g. started with arena up, instead of starting new ones. They are left running")
 }
 
-func (c *EnvConfig) AddFlags(flags *pflag.FlagSet) {
+// AddFlags adds the flags of the config, each bound to its environment variable.
+func (c *EnvConfig) AddFlags(fs *pflag.FlagSet) {
+	flags := pflag.NewFlagSet("env", pflag.ContinueOnError)
+	defer func() {
+		config.BindEnv(flags)
+		fs.AddFlagSet(flags)
+	}()
 	preallocatePort := false
 	if runtime.GOOS == "windows" {
 		// FIXME: Wrap this in condition that check if runtime is affected
@@ -151,27 +273,66 @@ func (c *EnvConfig) AddFlags(flags *pflag.FlagSet) {
 	// Flags that apply to both agent and env
 	flags.BoolVarP(&c.Interactive, "interactive", "i", true, "Open stdin for interactions with arena and agent")
 	flags.BoolVarP(&c.NoPullImage, "images.no-pull", "n", false, "Do not try to pull image before running")
+	flags.MarkDeprecated("images.no-pull", "use --images.pull never instead")
+	c.PullPolicy = PullAlways
+	flags.Var(&c.PullPolicy, "images.pull", "When to pull the env, agent and init images (always, missing, never). Each image is pulled at most once per run")
+	flags.StringVar(&c.Session, "session", "", "Name of the arena session. Reuses the envs of the session if running, otherwise starts them in it. Omit for a new unnamed session")
 
 	// Flags to configure env container
 	flags.IntVarP(&c.Scale, "env.scale", "s", 1, "Number of environments to run")
+	flags.Var(&c.Groups, "env.group", "Group of envs to run instead of --env.scale, as comma separated name, image, scale, render, lockfps and sound, e.g. image=diambra/engine:v2.2,scale=4,render=true. Unset values default to the --env.* and --engine.* flags. Can be repeated. DIAMBRA_ENVS lists the envs of all groups in the given order, DIAMBRA_ENVS_<NAME> those of each group, named by their index if unset")
 	flags.BoolVarP(&c.AutoRemove, "env.autoremove", "x", true, "Remove containers on exit")
+	c.Restart = RestartNo
+	flags.Var(&c.Restart, "env.restart", "Restart exited envs while running (no, on-failure, always)")
 	flags.StringVar(&c.Image, "env.image", "", "Env image to use, omit to detect from diambra-arena version")
 	flags.StringVar(&c.SeccompProfile, "env.seccomp", "unconfined", "Path to seccomp profile to use for env (may slow down environment). Set to \"\" for runtime's default profile.")
 	flags.StringSliceVar(&c.mounts, "env.mount", []string{}, "Host mounts for env container (/host/path:/container/path)")
 	flags.BoolVar(&c.PreallocatePort, "env.preallocateport", preallocatePort, "Preallocate port for env container. Workaround for port conflicts on Windows")
+	flags.Var(&c.Ports, "env.ports", "Range of host ports to publish the envs on (e.g 50051-50150). Ports in use are skipped. Random ports if unset")
 	flags.StringVar(&c.Host, "env.host", "127.0.0.1", "Host to bind ports on")
 	flags.BoolVar(&c.UseContainerIP, "env.containerip", false, "Use <containerIP>:<containerPort> instead of <env.host/localhost>:<hostPort>")
+	flags.IntVar(&c.StartParallelism, "env.start-parallelism", DefaultStartParallelism, "Number of envs to start at once")
+	flags.StringVar(&c.StopSignal, "env.stop-signal", DefaultStopSignal, "Signal to stop envs with, e.g SIGTERM for engines that exit on it")
+	flags.DurationVar(&c.StopTimeout, "env.stop-timeout", DefaultStopTimeout, "Time for envs to exit after the stop signal before they get killed")
+	flags.StringVar(&c.EnvResources.Memory, "env.memory", "", "Memory limit for each env container (e.g 2g), empty for unlimited")
+	flags.Float64Var(&c.EnvResources.CPUs, "env.cpus", 0, "Number of CPUs each env container can use, 0 for unlimited")
 
 	// Flags to configure engine in env container
 	flags.BoolVarP(&c.AppArgs.Render, "engine.render", "g", false, "Render graphics server side")
 	flags.BoolVarP(&c.AppArgs.LockFPS, "engine.lockfps", "l", false, "Lock FPS")
 	flags.BoolVar(&c.AppArgs.Sound, "engine.sound", false, "Enable sound")
+	flags.IntVar(&c.Seed, "engine.seed", 0, "Base of the random seeds, env N gets seed BASE+N. 0 for random seeds")
+	flags.StringToIntVar(&c.EnvSeeds, "engine.env-seed", nil, "Pin the seed of a single env as index=seed, e.g. to replay it. Can be repeated")
+	flags.StringToStringVar(&c.AppArgs.Extra, "engine.arg", nil, "Additional engine flag as name=value, appended to the engine command line. Empty value for switches. Can be repeated")
 
 	// Agent flags
 	flags.StringVarP(&c.AgentImage, "agent.image", "a", "", "Run given agent command in container")
+	flags.StringVar(&c.AgentResources.Memory, "agent.memory", c.AgentResources.Memory, "Memory limit for the agent container (e.g 2g), empty for unlimited")
+	flags.Float64Var(&c.AgentResources.CPUs, "agent.cpus", c.AgentResources.CPUs, "Number of CPUs the agent container can use, 0 for unlimited")
 
 	// Other flags
 	flags.StringVar(&c.InitImage, "init.image", "ghcr.io/diambra/init:main", "Init image to use")
+
+	// Log files
+	flags.StringVar(&c.LogFiles.Dir, "log.dir", "", "Write the output of each env, init and agent container to <log.dir>/<session>/<name>.log")
+	flags.StringVar(&c.LogFiles.MaxSize, "log.max-size", "10m", "Rotate log files once they reach this size, 0 to disable")
+	flags.IntVar(&c.LogFiles.MaxFiles, "log.max-files", 5, "Number of rotated log files to keep")
+
+	// Timeouts
+	flags.DurationVar(&c.Timeouts.Pull, "timeout.pull", 0, "Timeout for pulling each image, 0 to disable")
+	flags.DurationVar(&c.Timeouts.Start, "timeout.start", 0, "Timeout for starting each environment until it accepts connections, 0 to disable")
+	flags.DurationVar(&c.Timeouts.Ready, "timeout.ready", DefaultReadyTimeout, "Timeout for each started environment to get ready, including entering credentials on first start. 0 to disable")
+	flags.DurationVar(&c.Timeouts.Agent, "timeout.agent", 0, "Timeout for the agent to finish, 0 to disable")
+}
+
+func (c *EnvConfig) pullPolicy() PullPolicy {
+	if c.NoPullImage {
+		return PullNever
+	}
+	if c.PullPolicy == "" {
+		return PullAlways
+	}
+	return c.PullPolicy
 }
 
 func (c *EnvConfig) Validate() error {
@@ -188,18 +349,59 @@ func (c *EnvConfig) Validate() error {
 	}
 
 	if c.Image == "" {
-		tag := DefaultEnvImageTag
-		parts, err := GetInstalledPackageVersion("diambra-engine")
-		if err != nil || len(parts) != 3 || (parts[0] == "0" && parts[1] == "0" && parts[2] == "0") {
-			level.Warn(c.logger).Log(
-				"msg", "Can't find diambra-engine package to automatically determine engine image, using default version. Did you activate your virtual/condaenv?",
-				"tag", DefaultEnvImageTag,
-				"err", fmt.Sprintf("%v", err),
-			)
-		} else {
-			tag = "v" + strings.Join(parts[:2], ".")
+		c.Image, _ = DetectImage(c.logger)
+	}
+	if err := c.validateGroups(); err != nil {
+		return err
+	}
+
+	if err := c.validateEngineArgs(); err != nil {
+		return err
+	}
+	if err := c.validateSeeds(); err != nil {
+		return err
+	}
+
+	if c.StartParallelism < 0 {
+		return fmt.Errorf("invalid start parallelism %d", c.StartParallelism)
+	}
+	if c.StopSignal != "" && !signalRegexp.MatchString(c.StopSignal) {
+		return fmt.Errorf("invalid stop signal %s, must be a signal name like SIGTERM or number", c.StopSignal)
+	}
+	if c.StopTimeout < 0 {
+		return fmt.Errorf("invalid stop timeout %s", c.StopTimeout)
+	}
+
+	if n := c.Ports.Len(); n > 0 && n < c.Scale {
+		return fmt.Errorf("--env.ports %s has %d ports, not enough for %d envs", c.Ports.String(), n, c.Scale)
+	}
+
+	if c.Session != "" && !sessionRegexp.MatchString(c.Session) {
+		return fmt.Errorf("invalid session name %s, must match %s", c.Session, sessionRegexp)
+	}
+	if c.AttachSession != "" {
+		if !sessionRegexp.MatchString(c.AttachSession) {
+			return fmt.Errorf("invalid session name %s, must match %s", c.AttachSession, sessionRegexp)
+		}
+		if c.Session != "" && c.Session != c.AttachSession {
+			return fmt.Errorf("--session and --attach-session can't select different sessions")
 		}
-		c.Image = fmt.Sprintf("%s/%s:%s", DefaultEnvRegistry, DefaultEnvImageName, tag)
+		if c.SessionsDir == "" {
+			return fmt.Errorf("--attach-session requires sessions to be recorded")
+		}
+	}
+
+	for name, r := range map[string]Resources{"env": c.EnvResources, "agent": c.AgentResources} {
+		if err := r.Apply(&container.Container{}); err != nil {
+			return fmt.Errorf("invalid %s resources: %w", name, err)
+		}
+	}
+
+	if _, err := c.LogFiles.maxSize(); err != nil {
+		return err
+	}
+	if c.LogFiles.MaxFiles < 0 {
+		return fmt.Errorf("invalid number of log files %d", c.LogFiles.MaxFiles)
 	}
 
 	c.Mounts = make([]*container.BindMount, len(c.mounts))
@@ -213,6 +415,44 @@ func (c *EnvConfig) Validate() error {
 	return nil
 }
 
+// validateSeeds checks --engine.seed and the seeds pinned by --engine.env-seed.
+func (c *EnvConfig) validateSeeds() error {
+	if c.Seed < 0 || c.Seed > math.MaxInt32-c.Scale {
+		return fmt.Errorf("invalid --engine.seed %d, must be between 1 and %d, or 0 for random seeds", c.Seed, math.MaxInt32-c.Scale)
+	}
+	c.envSeeds = make(map[int]int, len(c.EnvSeeds))
+	for k, seed := range c.EnvSeeds {
+		index, err := strconv.Atoi(k)
+		if err != nil || index < 0 || index >= c.Scale {
+			return fmt.Errorf("invalid --engine.env-seed %s=%d, no env with index %s", k, seed, k)
+		}
+		if seed <= 0 {
+			return fmt.Errorf("invalid --engine.env-seed %s=%d, seed must be positive", k, seed)
+		}
+		c.envSeeds[index] = seed
+	}
+	return nil
+}
+
+// DetectImage returns the env image matching the version of the installed
+// diambra-engine package. If there's none, it returns the default image and
+// false.
+func DetectImage(logger log.Logger) (string, bool) {
+	tag := DefaultEnvImageTag
+	parts, err := GetInstalledPackageVersion("diambra-engine")
+	detected := err == nil && len(parts) == 3 && !(parts[0] == "0" && parts[1] == "0" && parts[2] == "0")
+	if detected {
+		tag = "v" + strings.Join(parts[:2], ".")
+	} else {
+		level.Warn(logger).Log(
+			"msg", "Can't find diambra-engine package to automatically determine engine image, using default version. Did you activate your virtual/condaenv?",
+			"tag", DefaultEnvImageTag,
+			"err", fmt.Sprintf("%v", err),
+		)
+	}
+	return fmt.Sprintf("%s/%s:%s", DefaultEnvRegistry, DefaultEnvImageName, tag), detected
+}
+
 func pathExistsAndIsDir(path string) (bool, bool) {
 	fi, err := os.Stat(path)
 	if err != nil {
@@ -259,12 +499,19 @@ func (c *SubmissionConfig) RegisterCredentialsProviders(logger log.Logger, home
 	c.RegisterCredentialsProvider("huggingface", secretsources.NewHuggingfaceCredentials(logger, home))
 }
 
-func (c *SubmissionConfig) AddFlags(flags *pflag.FlagSet) {
+// AddFlags adds the flags of the config, each bound to its environment variable.
+func (c *SubmissionConfig) AddFlags(fs *pflag.FlagSet) {
+	flags := pflag.NewFlagSet("submission", pflag.ContinueOnError)
+	defer func() {
+		config.BindEnv(flags)
+		fs.AddFlagSet(flags)
+	}()
 	flags.StringVar(&c.Mode, "submission.mode", string(client.ModeAIvsCOM), "Mode to use for evaluation")
 	flags.StringVar(&c.Difficulty, "submission.difficulty", string(DifficultyEasy), "Difficulty to use for evaluation")
 	flags.StringToStringVarP(&c.EnvVars, "submission.env", "e", nil, "Environment variables to pass to the agent")
 	flags.StringToStringVarP(&c.Sources, "submission.source", "u", nil, "Source urls to pass to the agent")
 	flags.StringToStringVar(&c.Secrets, "submission.secret", nil, "Secrets to pass to the agent")
+	config.MarkSecret(flags, "submission.secret")
 	flags.StringVar(&c.SecretsFrom, "submission.secrets-from", "", "Automatically add secrets. Supported values: git, huggingface")
 	flags.StringVar(&c.ManifestPath, "submission.manifest", "", "Path to manifest file.")
 	flags.IntVar(&c.SubmissionID, "submission.id", 0, "Submission ID to retrieve manifest from")
@@ -20,9 +20,12 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/diambra/cli/pkg/config"
+	"github.com/diambra/cli/pkg/container"
 	"github.com/diambra/cli/pkg/diambra/client"
 	"github.com/diambra/cli/pkg/secretsources"
 	"github.com/go-kit/log"
+	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -52,6 +55,14 @@ func TestAppArgs(t *testing.T) {
 			},
 			[]string{"--render", "--lockFps", "--sound", "--randomSeed", "23"},
 		},
+		{
+			"extra",
+			AppArgs{
+				Render: true,
+				Extra:  map[string]string{"zeta": "1", "--alpha": "a b", "switch": ""},
+			},
+			[]string{"--render", "--alpha", "a b", "--switch", "--zeta", "1"},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			assert.Equal(t, tc.appArgs.Args(), tc.expected)
@@ -59,6 +70,33 @@ func TestAppArgs(t *testing.T) {
 	}
 }
 
+func TestResources(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		resources Resources
+		memory    int64
+		cpus      float64
+		err       bool
+	}{
+		{"unlimited", Resources{}, 0, 0, false},
+		{"limited", Resources{Memory: "4g", CPUs: 1.5}, 4 << 30, 1.5, false},
+		{"invalid memory", Resources{Memory: "lots"}, 0, 0, true},
+		{"invalid cpus", Resources{CPUs: -1}, 0, 0, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &container.Container{}
+			err := tc.resources.Apply(c)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.memory, c.MemoryLimitBytes)
+			assert.Equal(t, tc.cpus, c.CPULimitCores)
+		})
+	}
+}
+
 func TestSubmissionConfig(t *testing.T) {
 	envConfig := &EnvConfig{
 		logger:   log.NewNopLogger(),
@@ -183,3 +221,15 @@ func TestSubmissionConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestFlagsEnv(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	(&EnvConfig{}).AddFlags(flags)
+	(&SubmissionConfig{}).AddFlags(flags)
+	flags.VisitAll(func(f *pflag.Flag) {
+		assert.Equal(t, config.EnvVar(f.Name), config.EnvVars(f)[0], f.Name)
+		assert.Contains(t, f.Usage, "$"+config.EnvVar(f.Name), f.Name)
+	})
+	assert.Equal(t, []string{"DIAMBRA_PATH_ROMS", "DIAMBRAROMSPATH"}, config.EnvVars(flags.Lookup("path.roms")))
+	assert.NotNil(t, flags.Lookup("submission.difficulty"))
+}
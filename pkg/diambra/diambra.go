@@ -16,19 +16,22 @@
 package diambra
 
 import (
+	"context"
 	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
 	"net"
 	"os"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-
 	"github.com/containerd/console"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -43,109 +46,291 @@ const (
 type Env struct {
 	*container.ContainerStatus
 	container.Address
+	Index int
+	Seed  int    // random seed the engine got started with, 0 if unknown
+	Group string // name of the env group, empty without groups
 }
 
 type Diambra struct {
 	log.Logger
 	console console.Console
 	container.Runner
-	Envs   []*Env
-	config *EnvConfig
+	Envs    []*Env
+	config  *EnvConfig
+	session string
+	reused  bool // envs belong to an already running session
+	network string
+	created bool // network got created by us
+
+	pulledMu sync.Mutex
+	pulled   map[string]bool // images pulled or found locally in this session
+
+	portsMu sync.Mutex
+	ports   map[int]bool // ports of --env.ports handed out or found in use
+
+	mu              sync.Mutex // guards the container status of Envs while supervised
+	supervisors     sync.WaitGroup
+	stopSupervisors context.CancelFunc
 	// streamer *ui.Streamer
 }
 
 // func NewDiambra(logger log.Logger, config *EnvConfig, streamer *ui.Streamer) (*Diambra, error) {
 
 func NewDiambra(logger log.Logger, console console.Console, runner container.Runner, config *EnvConfig) (*Diambra, error) {
+	session := config.Session
+	if config.AttachSession != "" {
+		session = config.AttachSession
+	}
+	if session == "" {
+		var err error
+		session, err = newSessionID()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't generate session id: %w", err)
+		}
+	}
 	return &Diambra{
 		Logger:  logger,
 		console: console,
 		Runner:  runner,
 		Envs:    []*Env{},
 		config:  config,
+		session: session,
+		network: "diambra-" + session,
+		pulled:  map[string]bool{},
+		ports:   map[int]bool{},
 	}, nil
 }
 
+func newSessionID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Session returns the name of the session the envs belong to.
+func (d *Diambra) Session() string {
+	return d.session
+}
+
+// containerName returns the name for a container of this session.
+func (d *Diambra) containerName(name string) string {
+	return fmt.Sprintf("diambra-%s-%s", d.session, name)
+}
+
+func (d *Diambra) labels(c *container.Container) {
+	if c.Labels == nil {
+		c.Labels = map[string]string{}
+	}
+	c.Labels[container.LabelSession] = d.session
+}
+
 // FIXME: check errors earlier so we don't have to here
 func (e *Diambra) EnvsString() (string, error) {
+	envs, err := e.endpoints(false)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(envs, " "), nil
+}
+
+// endpoints returns the endpoint of each env. With network set, these are
+// the endpoints on the session network.
+func (e *Diambra) endpoints(network bool) ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	portn, err := container.Port(ContainerPort).Number()
+	if err != nil {
+		return nil, err
+	}
 	envs := make([]string, len(e.Envs))
 	for i, env := range e.Envs {
-		portn, err := env.Port.Number()
-		if err != nil {
-			return "", fmt.Errorf("invalid port %s: %w", env.Port, err)
+		switch {
+		case network:
+			envs[i] = fmt.Sprintf("%s:%d", envAlias(env.Index), portn)
+		case e.config.UseContainerIP:
+			envs[i] = fmt.Sprintf("%s:%d", env.ContainerStatus.Address, portn)
+		default:
+			addr, err := HostAddress(env.Address)
+			if err != nil {
+				return nil, err
+			}
+			envs[i] = addr
 		}
-		host := env.Address.Host
-		if e.config.UseContainerIP {
-			host = env.ContainerStatus.Address
-			portn = 50051
-		} else {
-			if !net.ParseIP(host).IsLoopback() {
+	}
+	return envs, nil
+}
 
-				host = "127.0.0.1"
-			}
+// EnvVars returns the variables listing the endpoints for the agent:
+// DIAMBRA_ENVS lists the endpoints of all envs, ordered by group and then by
+// env within the group. With env groups, DIAMBRA_ENVS_<GROUP> lists the
+// endpoints of each group too. With network set, these are the endpoints on
+// the session network.
+func (e *Diambra) EnvVars(network bool) ([]string, error) {
+	envs, err := e.endpoints(network)
+	if err != nil {
+		return nil, err
+	}
+	vars := []string{"DIAMBRA_ENVS=" + strings.Join(envs, " ")}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	groups := []string{}
+	endpoints := map[string][]string{}
+	for i, env := range e.Envs {
+		if env.Group == "" {
+			continue
+		}
+		if _, ok := endpoints[env.Group]; !ok {
+			groups = append(groups, env.Group)
 		}
-		envs[i] = fmt.Sprintf("%s:%d", host, portn)
+		endpoints[env.Group] = append(endpoints[env.Group], envs[i])
 	}
-	return strings.Join(envs, " "), nil
+	for _, g := range groups {
+		vars = append(vars, groupEnvVar(g)+"="+strings.Join(endpoints[g], " "))
+	}
+	return vars, nil
+}
+
+// HostAddress returns the host:port to connect to a port published on the given address from this host.
+func HostAddress(addr container.Address) (string, error) {
+	portn, err := addr.Port.Number()
+	if err != nil {
+		return "", fmt.Errorf("invalid port %s: %w", addr.Port, err)
+	}
+	host := addr.Host
+	if !net.ParseIP(host).IsLoopback() {
+		host = "127.0.0.1"
+	}
+	return fmt.Sprintf("%s:%d", host, portn), nil
 }
 
-// FIXME: Merge with above
+// EnvsStringContainer returns the endpoints for containers on the session network.
 func (e *Diambra) EnvsStringContainer() (string, error) {
-	portn, err := container.Port(ContainerPort).Number()
+	envs, err := e.endpoints(true)
 	if err != nil {
 		return "", err
 	}
-	envs := make([]string, len(e.Envs))
-	for i, env := range e.Envs {
-		envs[i] = fmt.Sprintf("%s:%d", env.ContainerStatus.Address, portn)
-	}
 	return strings.Join(envs, " "), nil
 }
 
-func (e *Diambra) waitForGRPC(addr container.Address) error {
-	_, hp, err := addr.ProtoAddress()
+// envAlias returns the name of the env on the session network.
+func envAlias(envID int) string {
+	return fmt.Sprintf("arena-%d", envID)
+}
+
+var (
+	readyInterval     = time.Second
+	readyProbeTimeout = 5 * time.Second
+)
+
+const (
+	// tailLines is the number of log lines shown when an env exits before getting ready.
+	tailLines = 20
+	// tailGrace is how long to wait for the logs of an exited env to be copied.
+	tailGrace = time.Second
+)
+
+// waitReady probes the env until it's ready, it exits or the ready timeout expires.
+func (d *Diambra) waitReady(ctx context.Context, envID int, env *Env, tail *tailLogger) error {
+	_, hp, err := env.Address.ProtoAddress()
 	if err != nil {
 		return err
 	}
-	for {
-		_, err := grpc.Dial(hp, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	readyCtx, cancel := withTimeout(ctx, d.config.Timeouts.Ready)
+	defer cancel()
+
+	exited := make(chan error, 1)
+	go func() {
+		status, err := d.Runner.Wait(readyCtx, env.ID)
+		if readyCtx.Err() != nil {
+			return
+		}
 		if err != nil {
-			level.Debug(e.Logger).Log("msg", "couldn't connect to endpoint", "endpoint", hp, "err", err.Error())
-			time.Sleep(1 * time.Second)
-			continue
+			exited <- fmt.Errorf("env %d is gone: %w", envID, err)
+			return
 		}
-		return nil
+		exited <- fmt.Errorf("env %d exited with status %d before getting ready", envID, status)
+	}()
+
+	ticker := time.NewTicker(readyInterval)
+	defer ticker.Stop()
+	for {
+		probeCtx, probeCancel := context.WithTimeout(readyCtx, readyProbeTimeout)
+		err := Probe(probeCtx, hp)
+		probeCancel()
+		if err == nil {
+			level.Debug(d.Logger).Log("msg", "env ready", "envID", envID, "endpoint", hp)
+			return nil
+		}
+		level.Debug(d.Logger).Log("msg", "env not ready yet", "envID", envID, "endpoint", hp, "err", err.Error())
+
+		select {
+		case err := <-exited:
+			return tail.annotate(err)
+		case <-readyCtx.Done():
+			if ctx.Err() == nil && errors.Is(readyCtx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("env %d didn't get ready within %s (--timeout.ready): %w", envID, d.config.Timeouts.Ready, readyCtx.Err())
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// withTimeout returns a context with the given timeout, or without any deadline if the timeout is 0.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, timeout)
 }
+
+// RandInt returns a random seed between 1 and 0xFFFF. It's never 0, which
+// would leave the seed to the engine so the env couldn't be replayed.
 func (d *Diambra) RandInt() (int, error) {
 	n, err := rand.Int(rand.Reader, big.NewInt(0xFFFF))
 	if err != nil {
 		return 0, err
 	}
-	return int(n.Uint64()), nil
+	return int(n.Uint64()) + 1, nil
 }
 
-func (d *Diambra) start(envId int, first bool) error {
-	envLogger := log.With(d.Logger, "source", "env")
+// seed returns the seed of env envID. It's pinned by --engine.env-seed,
+// derived from --engine.seed or random.
+func (d *Diambra) seed(envID int) (int, error) {
+	if seed, ok := d.config.envSeeds[envID]; ok {
+		return seed, nil
+	}
+	if d.config.Seed > 0 {
+		return d.config.Seed + envID, nil
+	}
+	return d.RandInt()
+}
 
+// start starts the env container envId, published on port if --env.ports is
+// set. Only the first env attaches to the terminal, so it can ask for credentials.
+func (d *Diambra) start(ctx context.Context, envId, port int, first bool) error {
 	level.Debug(d.Logger).Log("msg", "creating env container", "envID", envId)
-	randomSeed, err := d.RandInt()
+	randomSeed, err := d.seed(envId)
 	if err != nil {
 		return fmt.Errorf("couldn't generate random seed: %w", err)
 	}
+	level.Info(d.Logger).Log("msg", "starting env", "envID", envId, "seed", randomSeed)
 
 	ec, err := newEnvContainer(d.config, envId, randomSeed)
 	if err != nil {
 		return fmt.Errorf("couldn't create env container: %w", err)
 	}
-
-	if first && !d.config.NoPullImage {
-		if err := d.Runner.Pull(ec, d.config.Output); err != nil {
-			return err
-		}
-	}
-
-	cs, err := d.Runner.Start(ec)
+	ec.Name = d.containerName(ec.Name)
+	ec.Network = d.network
+	ec.NetworkAliases = []string{envAlias(envId)}
+	d.labels(ec)
+
+	startCtx, cancel := withTimeout(ctx, d.config.Timeouts.Start)
+	defer cancel()
+	cs, err := d.startEnvContainer(startCtx, envId, port, ec)
 	if err != nil {
 		return err
 	}
@@ -153,16 +338,39 @@ func (d *Diambra) start(envId int, first bool) error {
 	env := &Env{
 		ContainerStatus: cs,
 		Address:         (*cs.PortMapping)[ContainerPort],
+		Index:           envId,
+		Seed:            randomSeed,
 	}
+	if g := d.config.group(envId); g != nil {
+		env.Group = g.Name
+	}
+	d.mu.Lock()
 	d.Envs = append(d.Envs, env)
+	d.mu.Unlock()
+
+	// The log file gets all output of the container, starting with what the
+	// first env prints while attached.
+	file := d.logFile(envAlias(envId))
+	var since time.Time
+	followed := false
+	defer func() {
+		if file != nil && !followed {
+			file.Close()
+		}
+	}()
 
 	// On first env we wait for the container to start, attach to it until the grpc port is open.
 	// This allows diambraEngine to ask for credentials if they don't exist/are expired.
-	if first && d.config.Tty && d.config.Interactive {
-		wc, rc, err := d.Runner.Attach(cs.ID)
+	interactive := first && d.config.Tty && d.config.Interactive
+	if interactive {
+		wc, rc, err := d.Runner.Attach(startCtx, cs.ID)
 		if err != nil {
 			return err
 		}
+		var out io.Writer = os.Stdout
+		if file != nil {
+			out = io.MultiWriter(os.Stdout, file)
+		}
 
 		if err := d.console.SetRaw(); err != nil {
 			return err
@@ -178,13 +386,17 @@ func (d *Diambra) start(envId int, first bool) error {
 		}
 
 		done := false
-		d.copyLogs(&done, wc, os.Stdin, os.Stdout, rc)
+		d.copyLogs(&done, wc, os.Stdin, out, rc)
 
-		level.Debug(d.Logger).Log("msg", "waiting for grpc")
-		if err := d.waitForGRPC(env.Address); err != nil {
-			return fmt.Errorf("error waiting for grpc: %w", err)
+		level.Debug(d.Logger).Log("msg", "waiting for env to get ready")
+		if err := d.waitReady(startCtx, envId, env, nil); err != nil {
+			// The log file gets closed.
+			done = true
+			return d.readyError(ctx, startCtx, envId, err)
 		}
 		level.Debug(d.Logger).Log("msg", "closing streamer")
+		// Output up to here got written to the file while attached.
+		since = time.Now()
 		done = true
 		wc.Close()
 		rc.Close()
@@ -193,21 +405,144 @@ func (d *Diambra) start(envId int, first bool) error {
 		}
 
 	}
-	go func(id string) {
+	tail := d.followLogs(ctx, envId, cs.ID, since, file)
+	followed = true
+
+	if !interactive {
+		level.Debug(d.Logger).Log("msg", "waiting for env to get ready", "envID", envId)
+		if err := d.waitReady(startCtx, envId, env, tail); err != nil {
+			return d.readyError(ctx, startCtx, envId, err)
+		}
+	}
+
+	if d.config.Restart != RestartNo && d.config.Restart != "" {
+		d.supervisors.Add(1)
+		go d.supervise(ctx, envId, env, ec)
+	}
+	return nil
+}
+
+// startEnvContainer starts the env container. With --env.ports, it gets
+// published on port, moving on to the next free port of the range if the port
+// got taken before the container started.
+func (d *Diambra) startEnvContainer(ctx context.Context, envID, port int, c *container.Container) (*container.ContainerStatus, error) {
+	if d.config.Ports.Len() == 0 {
+		return d.Runner.Start(ctx, c)
+	}
+	for {
+		if port == 0 {
+			var err error
+			if port, err = d.allocatePort(); err != nil {
+				return nil, err
+			}
+		}
+		pm := &container.PortMapping{}
+		pm.AddPortMapping(ContainerPort, strconv.Itoa(port), d.config.Host)
+		c.PortMapping = pm
+		cs, err := d.Runner.Start(ctx, c)
+		if err != nil && isPortConflict(err) {
+			level.Warn(d.Logger).Log("msg", "port got taken, trying next one", "envID", envID, "port", port, "err", err.Error())
+			port = 0
+			continue
+		}
+		return cs, err
+	}
+}
+
+// followLogs logs the output of the env container since the given time, all
+// of it if zero, until it exits. It's also written to file if not nil, which
+// gets closed then.
+func (d *Diambra) followLogs(ctx context.Context, envID int, id string, since time.Time, file io.WriteCloser) *tailLogger {
+	tail := newTailLogger(log.With(d.Logger, "source", "env", "id", id), tailLines)
+	tail.file = file
+	go func() {
 		level.Debug(d.Logger).Log("msg", "in go func")
-		if err := d.Runner.LogLogs(id, log.With(envLogger, "id", id)); err != nil {
+		defer close(tail.done)
+		if err := d.Runner.LogLogs(ctx, id, since, tail); err != nil {
 			level.Warn(d.Logger).Log("msg", "LogLogs failed", "err", err.Error())
 		}
+		if file != nil {
+			if err := file.Close(); err != nil {
+				level.Warn(d.Logger).Log("msg", "couldn't close log file", "err", err.Error())
+			}
+		}
 		level.Debug(d.Logger).Log("msg", "end of go func")
-	}(cs.ID)
-
+	}()
 	level.Debug(d.Logger).Log("msg", "logs copying..")
-	return nil
+	return tail
+}
+
+// readyError explains err if the start timeout expired while waiting for the env.
+func (d *Diambra) readyError(ctx, startCtx context.Context, envID int, err error) error {
+	if ctx.Err() == nil && errors.Is(startCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("env %d didn't get ready within %s (--timeout.start): %w", envID, d.config.Timeouts.Start, err)
+	}
+	return err
+}
+
+// tailLogger passes log lines on to the next logger and keeps the last of
+// them. If file is set, the lines get written to it too.
+type tailLogger struct {
+	next log.Logger
+	max  int
+	done chan struct{} // closed once all logs got copied
+	file io.Writer
+
+	mu    sync.Mutex
+	lines []string
+}
+
+func newTailLogger(next log.Logger, max int) *tailLogger {
+	return &tailLogger{next: next, max: max, done: make(chan struct{})}
+}
+
+func (t *tailLogger) Log(keyvals ...interface{}) error {
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == "msg" {
+			line := fmt.Sprint(keyvals[i+1])
+			t.mu.Lock()
+			t.lines = append(t.lines, line)
+			if len(t.lines) > t.max {
+				t.lines = t.lines[len(t.lines)-t.max:]
+			}
+			if t.file != nil {
+				io.WriteString(t.file, line+"\n") //nolint:errcheck
+			}
+			t.mu.Unlock()
+		}
+	}
+	return t.next.Log(keyvals...)
+}
+
+// Lines returns the last lines logged.
+func (t *tailLogger) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string{}, t.lines...)
 }
 
-func (d *Diambra) copyLogs(done *bool, wc io.WriteCloser, in io.Reader, out io.Writer, rc io.ReadCloser) {
+// annotate adds the last lines logged by an exited container to err.
+func (t *tailLogger) annotate(err error) error {
+	if t == nil {
+		return err
+	}
+	select {
+	case <-t.done:
+	case <-time.After(tailGrace):
+	}
+	lines := t.Lines()
+	if len(lines) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w, last log lines:\n%s", err, strings.Join(lines, "\n"))
+}
+
+// copyLogs copies in to the container and its output to out. The returned
+// channel is closed once all output got copied.
+func (d *Diambra) copyLogs(done *bool, wc io.WriteCloser, in io.Reader, out io.Writer, rc io.ReadCloser) <-chan struct{} {
+	copied := make(chan struct{})
 	go func() {
-		if _, err := io.Copy(wc, os.Stdin); err != nil {
+		if _, err := io.Copy(wc, in); err != nil {
 			if *done {
 				return
 			}
@@ -215,49 +550,209 @@ func (d *Diambra) copyLogs(done *bool, wc io.WriteCloser, in io.Reader, out io.W
 		}
 	}()
 	go func() {
-		if _, err := io.Copy(os.Stdout, rc); err != nil {
+		defer close(copied)
+		if _, err := io.Copy(out, rc); err != nil {
 			if *done {
 				return
 			}
 			level.Error(d.Logger).Log("msg", "error copying container stdout to stdout", "err", err.Error())
 		}
 	}()
+	return copied
 }
 
-func (d *Diambra) Start() error {
+func (d *Diambra) Start(ctx context.Context) error {
 	level.Debug(d.Logger).Log("msg", "starting diambra", "config", fmt.Sprintf("%+v", d.config))
 	if err := d.config.Validate(); err != nil {
 		return err
 	}
-	first := true
-	for i := 0; i < d.config.Scale; i++ {
-		if err := d.start(i, first); err != nil {
+	if d.config.AttachSession != "" {
+		return d.attach(ctx)
+	}
+	if d.config.Session != "" {
+		reused, err := d.reuse(ctx)
+		if err != nil {
 			return err
 		}
-		first = false
+		if reused {
+			return nil
+		}
+	}
+	if err := d.Runner.CreateNetwork(ctx, d.network, map[string]string{container.LabelSession: d.session}); err != nil {
+		return fmt.Errorf("couldn't create network %s: %w", d.network, err)
+	}
+	d.created = true
 
+	ctx, d.stopSupervisors = context.WithCancel(ctx)
+	for _, image := range d.config.images() {
+		if err := d.pull(ctx, &container.Container{Image: image}); err != nil {
+			return err
+		}
+	}
+	if err := d.startEnvs(ctx); err != nil {
+		d.rollback(ctx)
+		return err
 	}
+	d.saveState()
 	return nil
 }
 
+// startEnvs starts the first env on its own, so it can ask for credentials,
+// and then the others with up to --env.start-parallelism at once. Once an env
+// failed, no more get started.
+func (d *Diambra) startEnvs(ctx context.Context) error {
+	// Hand out the ports in env order, so envs get the same ports every time.
+	ports := make([]int, d.config.Scale)
+	if d.config.Ports.Len() > 0 {
+		for i := range ports {
+			port, err := d.allocatePort()
+			if err != nil {
+				return err
+			}
+			ports[i] = port
+		}
+	}
+	if err := d.start(ctx, 0, ports[0], true); err != nil {
+		return err
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		rerr error
+		sem  = make(chan struct{}, max(d.config.StartParallelism, 1))
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return rerr != nil
+	}
+	for i := 1; i < d.config.Scale && !failed(); i++ {
+		sem <- struct{}{}
+		if failed() {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := d.start(ctx, i, ports[i], false); err != nil {
+				mu.Lock()
+				if rerr == nil {
+					rerr = err
+				}
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	d.mu.Lock()
+	sort.Slice(d.Envs, func(i, j int) bool { return d.Envs[i].Index < d.Envs[j].Index })
+	d.mu.Unlock()
+	return rerr
+}
+
+// rollback stops the envs started so far after Start failed. It keeps the
+// network, that gets removed by Cleanup.
+func (d *Diambra) rollback(ctx context.Context) {
+	d.stopSupervisors()
+	d.supervisors.Wait()
+	// The envs need to be stopped even if ctx got canceled.
+	ctx = context.WithoutCancel(ctx)
+	if err := d.stopEnvs(ctx); err != nil {
+		level.Warn(d.Logger).Log("msg", "couldn't stop envs started so far", "err", err.Error())
+		return
+	}
+	d.mu.Lock()
+	level.Debug(d.Logger).Log("msg", "stopped envs started so far", "envs", len(d.Envs))
+	d.Envs = []*Env{}
+	d.mu.Unlock()
+}
+
+// reuse looks for running envs in the session and uses them instead of
+// starting new ones. If the session only has leftover containers, they get
+// removed so they don't conflict with the new ones.
+func (d *Diambra) reuse(ctx context.Context) (bool, error) {
+	infos, err := d.Runner.List(ctx, d.session)
+	if err != nil {
+		return false, fmt.Errorf("couldn't list containers of session %s: %w", d.session, err)
+	}
+	type indexedEnv struct {
+		index int
+		env   *Env
+	}
+	envs := []indexedEnv{}
+	for _, info := range infos {
+		addr, ok := (*info.PortMapping)[ContainerPort]
+		if info.State != "running" || !ok {
+			continue
+		}
+		index, err := strconv.Atoi(info.Labels[container.LabelEnv])
+		if err != nil {
+			continue
+		}
+		status := info.ContainerStatus
+		envs = append(envs, indexedEnv{index, &Env{ContainerStatus: &status, Address: addr, Index: index}})
+	}
+	if len(envs) == 0 {
+		if len(infos) > 0 {
+			level.Debug(d.Logger).Log("msg", "removing leftover containers", "session", d.session)
+			if err := d.Runner.StopAll(ctx, d.session); err != nil {
+				return false, fmt.Errorf("couldn't remove leftover containers of session %s: %w", d.session, err)
+			}
+		}
+		return false, nil
+	}
+
+	sort.Slice(envs, func(i, j int) bool { return envs[i].index < envs[j].index })
+	recorded := map[int]EnvState{}
+	if s, err := LoadSessionState(d.config.SessionsDir, d.session); err == nil {
+		for _, es := range s.Envs {
+			recorded[es.Index] = es
+		}
+	}
+	for _, e := range envs {
+		e.env.Seed = recorded[e.index].Seed
+		e.env.Group = recorded[e.index].Group
+		d.Envs = append(d.Envs, e.env)
+	}
+	d.reused = true
+	d.saveState()
+	if len(d.Envs) != d.config.Scale {
+		level.Warn(d.Logger).Log("msg", "running session has a different number of envs than requested", "session", d.session, "envs", len(d.Envs), "scale", d.config.Scale)
+	}
+	level.Info(d.Logger).Log("msg", "reusing envs of running session", "session", d.session, "envs", len(d.Envs))
+	return true, nil
+}
+
 func newEnvContainer(config *EnvConfig, envID, randomSeed int) (*container.Container, error) {
 	pm := &container.PortMapping{}
 	hostPort := "0"
-	if config.PreallocatePort {
+	if config.PreallocatePort && config.Ports.Len() == 0 {
 		listener, err := net.Listen("tcp", ":0")
 		if err != nil {
 			return nil, err
 		}
 		hostPort = fmt.Sprintf("%d", listener.Addr().(*net.TCPAddr).Port)
+		if err := listener.Close(); err != nil {
+			return nil, err
+		}
 	}
 
 	pm.AddPortMapping(ContainerPort, hostPort, config.Host)
 
-	args := config.AppArgs
+	image, args := config.Image, config.AppArgs
+	if g := config.group(envID); g != nil {
+		image = g.Image
+		g.apply(&args)
+	}
 	args.RandomSeed = randomSeed
 	c := &container.Container{
-		Name:        fmt.Sprintf("arena-%3d", envID),
-		Image:       config.Image,
+		Name:        envAlias(envID),
+		Labels:      map[string]string{container.LabelEnv: strconv.Itoa(envID)},
+		Image:       image,
 		User:        config.User,
 		Args:        args.Args(),
 		PortMapping: pm,
@@ -265,11 +760,16 @@ func newEnvContainer(config *EnvConfig, envID, randomSeed int) (*container.Conta
 			container.NewBindMount(config.CredPath, "/tmp/.diambra/credentials"),
 			container.NewBindMount(config.RomsPath, "/opt/diambraArena/roms"),
 		},
-		Sound: args.Sound,
+		Sound:       args.Sound,
+		StopSignal:  config.StopSignal,
+		StopTimeout: config.StopTimeout,
 	}
 	c.BindMounts = append(c.BindMounts, config.Mounts...)
+	if err := config.EnvResources.Apply(c); err != nil {
+		return nil, err
+	}
 
-	if config.AppArgs.Render {
+	if args.Render {
 		if err := configureRender(config, c); err != nil {
 			return nil, fmt.Errorf("error configuring render: %w", err)
 		}
@@ -281,25 +781,84 @@ func newEnvContainer(config *EnvConfig, envID, randomSeed int) (*container.Conta
 	return c, nil
 }
 
-func (e *Diambra) Cleanup() error {
-	var rerr error
-	for _, env := range e.Envs {
-		level.Debug(e.Logger).Log("msg", "stopping container", "id", env.ContainerStatus.ID)
-		if err := e.Runner.Stop(env.ContainerStatus.ID); err != nil {
+// Cleanup stops all envs, unless they belong to a reused session. It's usually
+// called after the context passed to Start got canceled, so it takes its own context.
+func (e *Diambra) Cleanup(ctx context.Context) error {
+	if e.reused {
+		level.Debug(e.Logger).Log("msg", "not stopping envs of reused session", "session", e.session)
+		return nil
+	}
+	if e.stopSupervisors != nil {
+		e.stopSupervisors()
+	}
+	e.supervisors.Wait()
+
+	rerr := e.stopEnvs(ctx)
+	if e.created && rerr == nil {
+		if err := e.Runner.RemoveNetwork(ctx, e.network); err != nil {
 			rerr = err
-			level.Warn(e.Logger).Log("msg", "couldn't stop container", "err", err.Error())
+			level.Warn(e.Logger).Log("msg", "couldn't remove network", "name", e.network, "err", err.Error())
 		}
 	}
+	if rerr == nil {
+		e.removeState()
+	}
 	return rerr
 }
 
-func (e *Diambra) RunAgentImage(image string, args []string) error {
+// stopEnvs stops all envs in parallel, sending the stop signal first and
+// killing the ones that don't exit within the stop timeout.
+func (e *Diambra) stopEnvs(ctx context.Context) error {
+	opts := container.StopOptions{Signal: e.config.StopSignal, Timeout: e.config.StopTimeout}
+	if opts.Signal == "" {
+		opts.Signal = DefaultStopSignal
+	}
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		errs   []error
+		killed []string
+	)
+	e.mu.Lock()
+	envs := append([]*Env{}, e.Envs...)
+	e.mu.Unlock()
+	for _, env := range envs {
+		wg.Add(1)
+		go func(env *Env) {
+			defer wg.Done()
+			level.Debug(e.Logger).Log("msg", "stopping container", "id", env.ContainerStatus.ID, "signal", opts.Signal)
+			k, err := e.Runner.Terminate(ctx, env.ContainerStatus.ID, opts)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				level.Warn(e.Logger).Log("msg", "couldn't stop container", "id", env.ContainerStatus.ID, "err", err.Error())
+				errs = append(errs, fmt.Errorf("couldn't stop env %d: %w", env.Index, err))
+				return
+			}
+			if k {
+				killed = append(killed, envAlias(env.Index))
+			}
+		}(env)
+	}
+	wg.Wait()
+	if len(killed) > 0 {
+		sort.Strings(killed)
+		level.Warn(e.Logger).Log("msg", "envs didn't exit on stop signal in time and got killed", "envs", strings.Join(killed, ","), "signal", opts.Signal, "timeout", opts.Timeout)
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Diambra) RunAgentImage(ctx context.Context, image string, args []string) error {
 	level.Debug(e.Logger).Log("msg", "running in container", "image", image, "args", fmt.Sprintf("%v", args))
-	statusCode, err := e.RunAgentContainer(&container.Container{
+	c := &container.Container{
 		Name:  "agent",
 		Image: image,
 		Args:  args,
-	})
+	}
+	if err := e.config.AgentResources.Apply(c); err != nil {
+		return err
+	}
+	statusCode, err := e.RunAgentContainer(ctx, c)
 	if err != nil {
 		return err
 	}
@@ -309,37 +868,76 @@ func (e *Diambra) RunAgentImage(image string, args []string) error {
 	return nil
 }
 
-func (e *Diambra) RunAgentContainer(c *container.Container) (int, error) {
-	if !e.config.NoPullImage {
-		if err := e.Runner.Pull(c, e.config.Output); err != nil {
-			return 1, err
-		}
+func (e *Diambra) RunAgentContainer(ctx context.Context, c *container.Container) (int, error) {
+	if err := e.pull(ctx, c); err != nil {
+		return 1, err
 	}
-	envs, err := e.EnvsStringContainer()
+	vars, err := e.EnvVars(true)
 	if err != nil {
 		return 1, err
 	}
-	c.Env = append(c.Env, "DIAMBRA_ENVS="+envs)
+	c.Env = append(c.Env, vars...)
+	var (
+		out  io.Writer = os.Stdout
+		file io.WriteCloser
+	)
+	if c.Name != "" {
+		if file = e.logFile(c.Name); file != nil {
+			defer file.Close()
+			out = io.MultiWriter(os.Stdout, file)
+		}
+		// Runs overlapping in the same session or leaving their containers
+		// behind must not conflict.
+		suffix, err := newSessionID()
+		if err != nil {
+			return 1, fmt.Errorf("couldn't generate container name: %w", err)
+		}
+		c.Name = e.containerName(c.Name + "-" + suffix)
+	}
+	c.Network = e.network
+	e.labels(c)
 
-	cs, err := e.Runner.Start(c)
+	ctx, cancel := withTimeout(ctx, e.config.Timeouts.Agent)
+	defer cancel()
+	cs, err := e.Runner.Start(ctx, c)
 	if err != nil {
 		return 1, err
 	}
-	wc, rc, err := e.Runner.Attach(cs.ID)
+	wc, rc, err := e.Runner.Attach(ctx, cs.ID)
 	if err != nil {
+		if err := e.Runner.Stop(context.Background(), cs.ID); err != nil {
+			level.Warn(e.Logger).Log("msg", "couldn't stop container", "id", cs.ID, "err", err.Error())
+		}
 		return 1, err
 	}
 
 	done := false
-	e.copyLogs(&done, wc, os.Stdin, os.Stdout, rc)
+	copied := e.copyLogs(&done, wc, os.Stdin, out, rc)
 
 	level.Debug(e.Logger).Log("msg", "waiting for container to exit")
-	statusCode, err := e.Runner.Wait(cs.ID)
+	statusCode, err := e.Runner.Wait(ctx, cs.ID)
 	if err != nil {
+		done = true
+		if ctx.Err() != nil {
+			// Canceled or timed out, so the container is still running.
+			if err := e.Runner.Stop(context.Background(), cs.ID); err != nil {
+				level.Warn(e.Logger).Log("msg", "couldn't stop container", "id", cs.ID, "err", err.Error())
+			}
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return 1, fmt.Errorf("container didn't finish within %s (--timeout.agent): %w", e.config.Timeouts.Agent, err)
+		}
 		return 1, fmt.Errorf("couldn't wait for container to finish: %w", err)
 	}
 	wc.Close()
 	level.Debug(e.Logger).Log("msg", "waiting for stdout to close")
+	if file != nil {
+		// Make sure the log file is complete before it gets closed.
+		select {
+		case <-copied:
+		case <-time.After(tailGrace):
+		}
+	}
 	done = true
 
 	return statusCode, nil
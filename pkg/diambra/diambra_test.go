@@ -16,85 +16,537 @@
 package diambra
 
 import (
-	"io"
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/containerd/console"
 	"github.com/diambra/cli/pkg/container"
+	"github.com/diambra/cli/pkg/container/containertest"
+	"github.com/diambra/cli/pkg/diambra/diambratest"
 	"github.com/go-kit/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-// Implements Runner
-type mockRunner struct {
+// newTestConfig returns a config of a single env that passes validation
+// without network access, see diambratest.Setup.
+func newTestConfig(t *testing.T) *EnvConfig {
+	f := diambratest.Setup(t)
+	return &EnvConfig{
+		logger:      log.NewNopLogger(),
+		Scale:       1,
+		RomsPath:    f.RomsPath,
+		CredPath:    f.CredPath,
+		Image:       diambratest.Image,
+		Host:        diambratest.Host,
+		Output:      os.Stderr,
+		SessionsDir: f.SessionsDir,
+	}
 }
 
-func (r *mockRunner) Start(c *container.Container) (*container.ContainerStatus, error) {
-	panic("not implemented") // TODO: Implement
+func TestDiambra(t *testing.T) {
+	var (
+		logger = log.NewLogfmtLogger(os.Stderr)
+		assert = assert.New(t)
+
+		runner = containertest.NewRunner()
+		config = &EnvConfig{
+			AppArgs:        AppArgs{},
+			Scale:          1,
+			AutoRemove:     false,
+			AgentImage:     "",
+			NoPullImage:    false,
+			RomsPath:       os.TempDir(),
+			CredPath:       filepath.Join(os.TempDir(), "credfile"),
+			Image:          "",
+			User:           "",
+			SeccompProfile: "",
+			Tty:            false,
+			Interactive:    false,
+		}
+	)
+	_, err := NewDiambra(logger, nil, runner, config)
+	assert.NoError(err)
 }
 
-func (r *mockRunner) LogLogs(id string, logger log.Logger) error {
-	panic("not implemented") // TODO: Implement
+func TestDiambraStart(t *testing.T) {
+	config := newTestConfig(t)
+	config.Scale = 2
+	runner := containertest.NewRunner()
+	d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+
+	require.NoError(t, d.Start(context.Background()))
+	assert.Equal(t, []string{"diambra/engine:test"}, runner.Pulled())
+	assert.Len(t, runner.Running(), 2)
+
+	envs, err := d.EnvsString()
+	assert.NoError(t, err)
+	assert.Equal(t, runner.Containers()[0].Endpoint(ContainerPort)+" "+runner.Containers()[1].Endpoint(ContainerPort), envs)
+
+	envs, err = d.EnvsStringContainer()
+	assert.NoError(t, err)
+	assert.Equal(t, "arena-0:50051 arena-1:50051", envs)
+
+	network := "diambra-" + d.Session()
+	assert.Equal(t, []string{network}, runner.Networks())
+	for i, c := range runner.Containers() {
+		assert.Equal(t, network, c.Network)
+		assert.Equal(t, []string{fmt.Sprintf("arena-%d", i)}, c.NetworkAliases)
+	}
+
+	assert.NoError(t, d.Cleanup(context.Background()))
+	assert.Empty(t, runner.Running())
+	assert.Empty(t, runner.Networks())
 }
 
-func (r *mockRunner) Stop(id string) error {
-	panic("not implemented") // TODO: Implement
+func TestDiambraStartFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		step     containertest.Step
+		n        int
+		expected int // containers started
+	}{
+		{"pull", containertest.StepPull, 1, 0},
+		{"first start", containertest.StepStart, 1, 0},
+		{"second start", containertest.StepStart, 2, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := newTestConfig(t)
+			config.Scale = 2
+			runner := containertest.NewRunner()
+			errFail := errors.New("scripted failure")
+			runner.FailAt(tc.step, tc.n, errFail)
+			d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+			require.NoError(t, err)
+
+			assert.ErrorIs(t, d.Start(context.Background()), errFail)
+			assert.Len(t, runner.Containers(), tc.expected)
+			// Envs started so far got rolled back.
+			assert.Empty(t, runner.Running())
+			assert.NoError(t, d.Cleanup(context.Background()))
+			assert.Empty(t, runner.Running())
+		})
+	}
 }
 
-func (r *mockRunner) Attach(id string) (io.WriteCloser, io.ReadCloser, error) {
-	panic("not implemented") // TODO: Implement
+func TestDiambraStartParallel(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		parallelism int
+		failAt      int // start failing, 0 for none
+	}{
+		{"sequential", 1, 0},
+		{"parallel", 3, 0},
+		{"parallel failure", 3, 5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := newTestConfig(t)
+			config.Scale = 8
+			config.StartParallelism = tc.parallelism
+			runner := containertest.NewRunner()
+			errFail := errors.New("scripted failure")
+			if tc.failAt > 0 {
+				runner.FailAt(containertest.StepStart, tc.failAt, errFail)
+			}
+			d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+			require.NoError(t, err)
+			defer d.Cleanup(context.Background())
+
+			err = d.Start(context.Background())
+			assert.Equal(t, 1, runner.Calls(containertest.StepPull))
+			if tc.failAt > 0 {
+				assert.ErrorIs(t, err, errFail)
+				assert.Empty(t, d.Envs)
+				assert.Empty(t, runner.Running())
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, d.Envs, config.Scale)
+			for i, env := range d.Envs {
+				assert.Equal(t, i, env.Index)
+			}
+			envs, err := d.EnvsStringContainer()
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(envs, "arena-0:50051 arena-1:50051 "), envs)
+			assert.Len(t, runner.Running(), config.Scale)
+		})
+	}
 }
 
-func (r *mockRunner) Wait(id string) (int, error) {
-	panic("not implemented") // TODO: Implement
+func TestDiambraGroups(t *testing.T) {
+	config := newTestConfig(t)
+	config.AppArgs.Sound = true
+	require.NoError(t, config.Groups.Set("image=a:test,scale=2,lockfps=true"))
+	require.NoError(t, config.Groups.Set("name=eval,image=b:test,sound=false"))
+	runner := containertest.NewRunner()
+	d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+	require.NoError(t, d.Start(context.Background()))
+	defer d.Cleanup(context.Background())
+
+	assert.Equal(t, []string{"a:test", "b:test"}, runner.Pulled())
+	cs := runner.Containers()
+	require.Len(t, cs, 3)
+	for i, expected := range []struct {
+		image   string
+		lockFPS bool
+		sound   bool
+	}{
+		{"a:test", true, true},
+		{"a:test", true, true},
+		{"b:test", false, false},
+	} {
+		assert.Equal(t, expected.image, cs[i].Image)
+		assert.Equal(t, expected.lockFPS, slices.Contains(cs[i].Args, "--lockFps"), cs[i].Args)
+		assert.Equal(t, expected.sound, slices.Contains(cs[i].Args, "--sound"), cs[i].Args)
+	}
+
+	vars, err := d.EnvVars(true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"DIAMBRA_ENVS=arena-0:50051 arena-1:50051 arena-2:50051",
+		"DIAMBRA_ENVS_0=arena-0:50051 arena-1:50051",
+		"DIAMBRA_ENVS_EVAL=arena-2:50051",
+	}, vars)
+
+	state, err := d.State()
+	require.NoError(t, err)
+	assert.Equal(t, "eval", state.Envs[2].Group)
+	assert.Equal(t, []string{"name=0,image=a:test,scale=2,lockfps=true", "name=eval,image=b:test,scale=1,sound=false"}, state.Config.Groups)
 }
 
-func (r *mockRunner) Pull(c *container.Container, output *os.File) error {
-	panic("not implemented") // TODO: Implement
+func TestDiambraGroupsRender(t *testing.T) {
+	t.Setenv("WAYLAND_DISPLAY", "")
+	t.Setenv("DISPLAY", ":1")
+	for _, tc := range []struct {
+		name     string
+		render   bool
+		groups   string
+		expected []bool
+	}{
+		{"group renders", false, "render=true;name=headless", []bool{true, false}},
+		{"group headless", true, "name=headless,render=false;render=true", []bool{false, true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := newTestConfig(t)
+			config.AppArgs.Render = tc.render
+			require.NoError(t, config.Groups.Set(tc.groups))
+			runner := containertest.NewRunner()
+			d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+			require.NoError(t, err)
+			require.NoError(t, d.Start(context.Background()))
+			defer d.Cleanup(context.Background())
+
+			cs := runner.Containers()
+			require.Len(t, cs, len(tc.expected))
+			for i, render := range tc.expected {
+				mounts := []string{}
+				for _, m := range cs[i].BindMounts {
+					mounts = append(mounts, m.ContainerPath)
+				}
+				assert.Equal(t, render, slices.Contains(cs[i].Args, "--render"), cs[i].Args)
+				assert.Equal(t, render, slices.Contains(mounts, "/tmp/.X11-unix"), mounts)
+				assert.Equal(t, render, slices.Contains(cs[i].Env, "DISPLAY=:1"), cs[i].Env)
+			}
+		})
+	}
 }
 
-func (r *mockRunner) StopAll() error {
-	panic("not implemented") // TODO: Implement
+func TestDiambraCleanupError(t *testing.T) {
+	config := newTestConfig(t)
+	config.Scale = 2
+	runner := containertest.NewRunner()
+	d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+	require.NoError(t, d.Start(context.Background()))
+
+	errFail := errors.New("scripted failure")
+	runner.FailAt(containertest.StepTerminate, 1, errFail)
+	assert.ErrorIs(t, d.Cleanup(context.Background()), errFail)
+	// The remaining envs still get stopped.
+	assert.Len(t, runner.Running(), 1)
 }
 
-func (r *mockRunner) Build(path, tag string) error {
-	panic("not implemented") // TODO: Implement
+func TestDiambraCleanupStopTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		signal  string
+		ignore  bool
+		killed  bool
+		expCode int
+	}{
+		{"graceful", "SIGTERM", false, false, containertest.ExitCodeTerminated},
+		{"killed after timeout", "SIGTERM", true, true, containertest.ExitCodeStopped},
+		{"default", DefaultStopSignal, true, false, containertest.ExitCodeStopped},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := newTestConfig(t)
+			config.Scale = 2
+			config.StopSignal = tc.signal
+			config.StopTimeout = 10 * time.Millisecond
+			config.Session = "test"
+			runner := containertest.NewRunner()
+			runner.Behaviors["diambra-test-arena-1"] = containertest.Behavior{IgnoreStopSignal: tc.ignore}
+			var (
+				mu     sync.Mutex
+				killed []string
+			)
+			logger := log.LoggerFunc(func(keyvals ...interface{}) error {
+				mu.Lock()
+				defer mu.Unlock()
+				for i := 0; i+1 < len(keyvals); i += 2 {
+					if keyvals[i] == "envs" {
+						killed = append(killed, keyvals[i+1].(string))
+					}
+				}
+				return nil
+			})
+			d, err := NewDiambra(logger, nil, runner, config)
+			require.NoError(t, err)
+			require.NoError(t, d.Start(context.Background()))
+
+			require.NoError(t, d.Cleanup(context.Background()))
+			assert.Empty(t, runner.Running())
+			cs := runner.Containers()
+			require.Len(t, cs, 2)
+			assert.Equal(t, tc.signal, cs[1].StopSignal)
+			assert.Equal(t, tc.expCode, cs[1].ExitCode())
+			mu.Lock()
+			defer mu.Unlock()
+			if tc.killed {
+				assert.Equal(t, []string{"arena-1"}, killed)
+			} else {
+				assert.Empty(t, killed)
+			}
+		})
+	}
 }
 
-func (r *mockRunner) Push(tag string) error {
-	panic("not implemented") // TODO: Implement
+func TestDiambraRunAgentContainer(t *testing.T) {
+	config := newTestConfig(t)
+	runner := containertest.NewRunner()
+	runner.Behaviors["agent:test"] = containertest.Behavior{Output: "hello\n", Exit: true, ExitCode: 3}
+	d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+	require.NoError(t, d.Start(context.Background()))
+	defer d.Cleanup(context.Background())
+
+	status, err := d.RunAgentContainer(context.Background(), &container.Container{Image: "agent:test"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, status)
+	assert.Equal(t, []string{"diambra/engine:test", "agent:test"}, runner.Pulled())
+
+	agent := runner.Containers()[1]
+	assert.Contains(t, agent.Env, "DIAMBRA_ENVS=arena-0:50051")
+	assert.Equal(t, "diambra-"+d.Session(), agent.Network)
 }
 
-func (r *mockRunner) Login(server, username, password string) {
-	panic("not implemented") // TODO: Implement
+// testConsole is the console of an interactive test run.
+type testConsole struct {
+	console.Console
 }
 
-func (r *mockRunner) TagExists(tag string) (bool, error) {
-	panic("not implemented") // TODO: Implement
+func (testConsole) SetRaw() error { return nil }
+func (testConsole) Reset() error  { return nil }
+func (testConsole) Size() (console.WinSize, error) {
+	return console.WinSize{Height: 24, Width: 80}, nil
 }
+func (testConsole) Resize(ws console.WinSize) error { return nil }
 
-func TestDiambra(t *testing.T) {
-	var (
-		logger = log.NewLogfmtLogger(os.Stderr)
-		assert = assert.New(t)
+func TestDiambraLogFiles(t *testing.T) {
+	for _, interactive := range []bool{false, true} {
+		t.Run(fmt.Sprintf("interactive %t", interactive), func(t *testing.T) {
+			config := newTestConfig(t)
+			config.Scale = 2
+			config.Tty = interactive
+			config.Interactive = interactive
+			config.LogFiles = LogFiles{Dir: t.TempDir(), MaxSize: "1m", MaxFiles: 1}
+			runner := containertest.NewRunner()
+			runner.Behaviors["diambra/engine:test"] = containertest.Behavior{Output: "starting\nready\n"}
+			runner.Behaviors["agent:test"] = containertest.Behavior{Output: "hello\n", Exit: true}
+			d, err := NewDiambra(log.NewNopLogger(), testConsole{}, runner, config)
+			require.NoError(t, err)
+			require.NoError(t, d.Start(context.Background()))
 
-		runner = &mockRunner{}
-		config = &EnvConfig{
-			AppArgs:        AppArgs{},
-			Scale:          1,
-			AutoRemove:     false,
-			AgentImage:     "",
-			NoPullImage:    false,
-			RomsPath:       os.TempDir(),
-			CredPath:       filepath.Join(os.TempDir(), "credfile"),
-			Image:          "",
-			User:           "",
-			SeccompProfile: "",
-			Tty:            false,
-			Interactive:    false,
-		}
-	)
-	_, err := NewDiambra(logger, nil, runner, config)
-	assert.NoError(err)
+			status, err := d.RunAgentContainer(context.Background(), &container.Container{Name: "agent", Image: "agent:test"})
+			require.NoError(t, err)
+			assert.Equal(t, 0, status)
+			require.NoError(t, d.Cleanup(context.Background()))
+
+			dir := filepath.Join(config.LogFiles.Dir, d.Session())
+			b, err := os.ReadFile(filepath.Join(dir, "agent.log"))
+			require.NoError(t, err)
+			assert.Equal(t, "hello\n", string(b))
+			// All output since the start of the envs, once.
+			for _, name := range []string{"arena-0.log", "arena-1.log"} {
+				assert.Eventually(t, func() bool {
+					b, err := os.ReadFile(filepath.Join(dir, name))
+					return err == nil && string(b) == "starting\nready\n"
+				}, time.Second, 10*time.Millisecond, name)
+			}
+		})
+	}
+}
+
+func TestDiambraRunAgentContainerTimeout(t *testing.T) {
+	config := newTestConfig(t)
+	config.PullPolicy = PullNever
+	config.Timeouts.Agent = time.Millisecond
+	runner := containertest.NewRunner()
+	runner.Images = map[string]bool{"diambra/engine:test": true, "agent:test": true}
+	d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+	require.NoError(t, d.Start(context.Background()))
+	defer d.Cleanup(context.Background())
+
+	_, err = d.RunAgentContainer(context.Background(), &container.Container{Image: "agent:test"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, runner.Pulled())
+	// The agent container got stopped, only the env is still running.
+	assert.Len(t, runner.Running(), 1)
+}
+
+func TestDiambraSession(t *testing.T) {
+	config := newTestConfig(t)
+	config.Scale = 2
+	config.Session = "foo"
+	runner := containertest.NewRunner()
+	runner.Behaviors["agent:test"] = containertest.Behavior{Exit: true}
+	owner, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", owner.Session())
+	require.NoError(t, owner.Start(context.Background()))
+
+	// A second user of the session reuses the envs and leaves them running.
+	d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+	require.NoError(t, d.Start(context.Background()))
+	envs, err := d.EnvsString()
+	assert.NoError(t, err)
+	assert.Equal(t, runner.Containers()[0].Endpoint(ContainerPort)+" "+runner.Containers()[1].Endpoint(ContainerPort), envs)
+
+	// Agents of the same session get their own containers.
+	for i := 2; i < 4; i++ {
+		_, err = d.RunAgentContainer(context.Background(), &container.Container{Name: "agent", Image: "agent:test"})
+		assert.NoError(t, err)
+		agent := runner.Containers()[i]
+		assert.Regexp(t, "^diambra-foo-agent-[0-9a-f]{8}$", agent.Name)
+		assert.Equal(t, "foo", agent.Labels[container.LabelSession])
+	}
+	assert.NotEqual(t, runner.Containers()[2].Name, runner.Containers()[3].Name)
+
+	assert.NoError(t, d.Cleanup(context.Background()))
+	assert.Len(t, runner.Running(), 2)
+	assert.Equal(t, []string{"diambra-foo"}, runner.Networks())
+
+	assert.NoError(t, owner.Cleanup(context.Background()))
+	assert.Empty(t, runner.Running())
+	assert.Empty(t, runner.Networks())
+}
+
+func TestDiambraSessionLeftovers(t *testing.T) {
+	config := newTestConfig(t)
+	config.Session = "foo"
+	runner := containertest.NewRunner()
+	d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+	require.NoError(t, d.Start(context.Background()))
+	require.NoError(t, d.Cleanup(context.Background()))
+
+	// The exited env isn't auto removed, so its name would conflict.
+	d, err = NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+	require.NoError(t, d.Start(context.Background()))
+	assert.Len(t, runner.Running(), 1)
+	assert.Equal(t, 1, runner.Calls(containertest.StepStopAll))
+}
+
+func TestDiambraSessionInvalid(t *testing.T) {
+	config := newTestConfig(t)
+	config.Session = "../foo"
+	d, err := NewDiambra(log.NewNopLogger(), nil, containertest.NewRunner(), config)
+	require.NoError(t, err)
+	assert.Error(t, d.Start(context.Background()))
+}
+
+func TestDiambraStartNotReady(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		behavior containertest.Behavior
+		err      string
+	}{
+		{"exited", containertest.Behavior{Output: "starting\nno roms found\n", Exit: true, ExitCode: 1}, "env 1 exited with status 1 before getting ready, last log lines:\nstarting\nno roms found"},
+		{"not serving", containertest.Behavior{NotServing: true}, "env 1 didn't get ready within 50ms (--timeout.ready)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := newTestConfig(t)
+			config.Scale = 2
+			config.Timeouts.Ready = 50 * time.Millisecond
+			config.Session = "test"
+			runner := containertest.NewRunner()
+			// Only the second env fails, so every env needs to be checked.
+			runner.Behaviors["diambra-test-arena-1"] = tc.behavior
+			d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+			require.NoError(t, err)
+
+			err = d.Start(context.Background())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+			assert.NoError(t, d.Cleanup(context.Background()))
+			assert.Empty(t, runner.Running())
+		})
+	}
+}
+
+func TestDiambraPullPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy PullPolicy
+		noPull bool
+		local  []string
+		pulled []string
+		err    bool
+	}{
+		{"always", PullAlways, false, []string{"diambra/engine:test"}, []string{"diambra/engine:test", "agent:test"}, false},
+		{"missing", PullMissing, false, []string{"diambra/engine:test"}, []string{"agent:test"}, false},
+		{"never", PullNever, false, []string{"diambra/engine:test", "agent:test"}, []string{}, false},
+		{"never without local image", PullNever, false, []string{"diambra/engine:test"}, []string{}, true},
+		{"deprecated no-pull", PullAlways, true, []string{"diambra/engine:test", "agent:test"}, []string{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := newTestConfig(t)
+			config.Scale = 2
+			config.PullPolicy = tc.policy
+			config.NoPullImage = tc.noPull
+			runner := containertest.NewRunner()
+			runner.Behaviors["agent:test"] = containertest.Behavior{Exit: true}
+			for _, image := range tc.local {
+				runner.Images[image] = true
+			}
+			d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+			require.NoError(t, err)
+			require.NoError(t, d.Start(context.Background()))
+			defer d.Cleanup(context.Background())
+
+			// Running the agent twice, like the init and agent container, pulls it once.
+			for i := 0; i < 2; i++ {
+				_, err = d.RunAgentContainer(context.Background(), &container.Container{Image: "agent:test"})
+				if tc.err {
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+				}
+			}
+			assert.Equal(t, tc.pulled, runner.Pulled())
+		})
+	}
 }
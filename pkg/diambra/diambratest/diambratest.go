@@ -0,0 +1,61 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package diambratest provides the fixtures needed by env configs in tests.
+// It doesn't import package diambra, so the tests of that package can use it
+// too.
+package diambratest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	Image = "diambra/engine:test"
+	Host  = "127.0.0.1"
+)
+
+// Fixture holds the paths to use in the config of a test.
+type Fixture struct {
+	RomsPath    string
+	CredPath    string
+	SessionsDir string
+}
+
+// Setup returns a roms path, credentials and a fake DIAMBRA API, so configs
+// using them pass validation without network access.
+func Setup(t testing.TB) Fixture {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id": 1, "username": "test"}`))
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("DIAMBRA_API_URL", srv.URL)
+
+	dir := t.TempDir()
+	f := Fixture{
+		RomsPath:    dir,
+		CredPath:    filepath.Join(dir, "credentials"),
+		SessionsDir: filepath.Join(dir, "sessions"),
+	}
+	if err := os.WriteFile(f.CredPath, []byte("token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
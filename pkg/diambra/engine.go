@@ -0,0 +1,131 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diambra
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log/level"
+)
+
+// engineVersion is the version of an engine image, e.g v2.2.
+type engineVersion struct {
+	Major, Minor int
+}
+
+// engineFlags lists the engine flags that can be passed with --engine.arg,
+// starting with the engine version they got introduced in. Images of unknown
+// version are expected to know all of them. The flags set from their own cli
+// flags are in managedEngineFlags instead. None are documented by the engine
+// yet, so flags should be added here as it documents them.
+var engineFlags = []struct {
+	Since engineVersion
+	Flags []string
+}{}
+
+// managedEngineFlags are the engine flags set from their own cli flags, which
+// can't be passed with --engine.arg.
+var managedEngineFlags = map[string]string{
+	"render":     "--engine.render",
+	"lockFps":    "--engine.lockfps",
+	"sound":      "--engine.sound",
+	"randomSeed": "",
+}
+
+var engineTagRegexp = regexp.MustCompile(`:v(\d+)\.(\d+)`)
+
+// imageEngineVersion returns the engine version of the image, if its tag
+// tells.
+func imageEngineVersion(image string) (engineVersion, bool) {
+	m := engineTagRegexp.FindStringSubmatch(image)
+	if m == nil {
+		return engineVersion{}, false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return engineVersion{major, minor}, true
+}
+
+func (v engineVersion) less(o engineVersion) bool {
+	return v.Major < o.Major || (v.Major == o.Major && v.Minor < o.Minor)
+}
+
+func (v engineVersion) String() string {
+	return fmt.Sprintf("v%d.%d", v.Major, v.Minor)
+}
+
+// knownEngineFlags returns the flags the engine of the image lets pass with
+// --engine.arg.
+func knownEngineFlags(image string) map[string]bool {
+	version, ok := imageEngineVersion(image)
+	known := map[string]bool{}
+	for _, f := range engineFlags {
+		if ok && version.less(f.Since) {
+			continue
+		}
+		for _, name := range f.Flags {
+			known[name] = true
+		}
+	}
+	return known
+}
+
+// engineArgName returns the name of the engine flag given to --engine.arg,
+// which may start with dashes.
+func engineArgName(key string) string {
+	return strings.TrimLeft(key, "-")
+}
+
+// validateEngineArgs checks the flags given by --engine.arg. Managed flags are
+// rejected, flags unknown to the engine of any image to start are passed on
+// with a warning.
+func (c *EnvConfig) validateEngineArgs() error {
+	keys := make([]string, 0, len(c.AppArgs.Extra))
+	for k := range c.AppArgs.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		name := engineArgName(k)
+		if name == "" {
+			return fmt.Errorf("invalid --engine.arg %s=%s, missing flag name", k, c.AppArgs.Extra[k])
+		}
+		if flag, ok := managedEngineFlags[name]; ok {
+			if flag == "" {
+				return fmt.Errorf("engine flag --%s is set by the cli and can't be passed with --engine.arg", name)
+			}
+			return fmt.Errorf("engine flag --%s can't be passed with --engine.arg, use %s instead", name, flag)
+		}
+	}
+	for _, image := range c.images() {
+		known := knownEngineFlags(image)
+		version := "unknown"
+		if v, ok := imageEngineVersion(image); ok {
+			version = v.String()
+		}
+		for _, k := range keys {
+			if name := engineArgName(k); !known[name] {
+				level.Warn(c.logger).Log("msg", "unknown engine flag, passing it anyway", "flag", "--"+name, "image", image, "version", version)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diambra
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withEngineFlags sets the pass-through engine flags for the test.
+func withEngineFlags(t *testing.T) {
+	saved := engineFlags
+	t.Cleanup(func() { engineFlags = saved })
+	engineFlags = []struct {
+		Since engineVersion
+		Flags []string
+	}{
+		{engineVersion{2, 0}, []string{"oldFlag"}},
+		{engineVersion{2, 2}, []string{"newFlag"}},
+	}
+}
+
+func TestValidateEngineArgs(t *testing.T) {
+	withEngineFlags(t)
+	for _, tc := range []struct {
+		name   string
+		image  string
+		groups []string
+		extra  map[string]string
+		warn   []string
+		err    string
+	}{
+		{"none", "diambra/engine:v2.2", nil, nil, nil, ""},
+		{"known", "diambra/engine:v2.2", nil, map[string]string{"--oldFlag": "1", "newFlag": ""}, nil, ""},
+		{"unknown", "diambra/engine:v2.2", nil, map[string]string{"--randomSeed2": "1", "oldFlag": ""}, []string{"flag=--randomSeed2"}, ""},
+		{"too new", "diambra/engine:v2.1", nil, map[string]string{"newFlag": "1"}, []string{"flag=--newFlag image=diambra/engine:v2.1 version=v2.1"}, ""},
+		{"unknown version", "diambra/engine:latest", nil, map[string]string{"newFlag": "1", "foo": ""}, []string{"flag=--foo image=diambra/engine:latest version=unknown"}, ""},
+		{"groups", "diambra/engine:v2.2", []string{"image=diambra/engine:v2.1", "name=eval"}, map[string]string{"newFlag": "1"}, []string{"image=diambra/engine:v2.1"}, ""},
+		{"managed", "diambra/engine:v2.2", nil, map[string]string{"--render": ""}, nil, "engine flag --render can't be passed with --engine.arg, use --engine.render instead"},
+		{"seed", "diambra/engine:v2.2", nil, map[string]string{"randomSeed": "1"}, nil, "engine flag --randomSeed is set by the cli and can't be passed with --engine.arg"},
+		{"empty name", "diambra/engine:v2.2", nil, map[string]string{"--": "1"}, nil, "invalid --engine.arg --=1, missing flag name"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := &bytes.Buffer{}
+			c := &EnvConfig{logger: log.NewLogfmtLogger(logs), Image: tc.image, Scale: 1, AppArgs: AppArgs{Extra: tc.extra}}
+			require.NoError(t, c.Groups.Replace(tc.groups))
+			require.NoError(t, c.validateGroups())
+			err := c.validateEngineArgs()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+			if len(tc.warn) == 0 {
+				assert.Empty(t, logs.String())
+				return
+			}
+			require.Len(t, lines, len(tc.warn), logs.String())
+			for i, warn := range tc.warn {
+				assert.Contains(t, lines[i], "unknown engine flag")
+				assert.Contains(t, lines[i], warn)
+			}
+		})
+	}
+}
+
+func TestKnownEngineFlags(t *testing.T) {
+	withEngineFlags(t)
+	assert.True(t, knownEngineFlags("docker.io/diambra/engine:v2.2")["newFlag"])
+	assert.True(t, knownEngineFlags("docker.io/diambra/engine:v2.2")["oldFlag"])
+	assert.False(t, knownEngineFlags("docker.io/diambra/engine:v2.1")["newFlag"])
+	assert.True(t, knownEngineFlags("engine:custom")["newFlag"])
+}
+
+func TestRandIntSeed(t *testing.T) {
+	d := &Diambra{}
+	for i := 0; i < 1000; i++ {
+		seed, err := d.RandInt()
+		assert.NoError(t, err)
+		// 0 would omit --randomSeed.
+		assert.True(t, seed >= 1 && seed <= 0xFFFF, "seed %d", seed)
+	}
+}
+
+func TestValidateSeeds(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		seed     int
+		envSeeds map[string]int
+		expected map[int]int
+		err      string
+	}{
+		{"random", 0, nil, map[int]int{}, ""},
+		{"pinned", 10, map[string]int{"0": 5, "1": 3}, map[int]int{0: 5, 1: 3}, ""},
+		{"negative base", -1, nil, nil, "invalid --engine.seed -1, must be between 1 and 2147483645, or 0 for random seeds"},
+		{"no env", 0, map[string]int{"2": 5}, nil, "invalid --engine.env-seed 2=5, no env with index 2"},
+		{"invalid index", 0, map[string]int{"a": 5}, nil, "invalid --engine.env-seed a=5, no env with index a"},
+		{"invalid seed", 0, map[string]int{"1": 0}, nil, "invalid --engine.env-seed 1=0, seed must be positive"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &EnvConfig{Scale: 2, Seed: tc.seed, EnvSeeds: tc.envSeeds}
+			err := c.validateSeeds()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, c.envSeeds)
+		})
+	}
+}
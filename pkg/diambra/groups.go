@@ -0,0 +1,236 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diambra
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EnvGroup is a group of envs started from the same image with the same
+// engine flags. Unset values default to those of the EnvConfig.
+type EnvGroup struct {
+	Name    string // defaults to the index of the group
+	Image   string
+	Scale   int
+	Render  *bool
+	LockFPS *bool
+	Sound   *bool
+}
+
+var groupNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// ParseEnvGroup parses a group given as comma separated key=value pairs, e.g
+// image=diambra/engine:v2.2,scale=4,render=true.
+func ParseEnvGroup(s string) (EnvGroup, error) {
+	g := EnvGroup{Scale: 1}
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return g, fmt.Errorf("invalid env group %s, expected key=value pairs", s)
+		}
+		var err error
+		switch k {
+		case "name":
+			if !groupNameRegexp.MatchString(v) {
+				return g, fmt.Errorf("invalid env group name %s, must match %s", v, groupNameRegexp)
+			}
+			g.Name = v
+		case "image":
+			g.Image = v
+		case "scale":
+			if g.Scale, err = strconv.Atoi(v); err != nil || g.Scale < 1 {
+				return g, fmt.Errorf("invalid scale %s of env group %s, must be at least 1", v, s)
+			}
+		case "render":
+			g.Render, err = parseBoolPtr(v)
+		case "lockfps":
+			g.LockFPS, err = parseBoolPtr(v)
+		case "sound":
+			g.Sound, err = parseBoolPtr(v)
+		default:
+			return g, fmt.Errorf("unknown key %s in env group %s, must be one of name, image, scale, render, lockfps, sound", k, s)
+		}
+		if err != nil {
+			return g, fmt.Errorf("invalid %s of env group %s: %w", k, s, err)
+		}
+	}
+	return g, nil
+}
+
+func parseBoolPtr(s string) (*bool, error) {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (g EnvGroup) String() string {
+	pairs := []string{}
+	if g.Name != "" {
+		pairs = append(pairs, "name="+g.Name)
+	}
+	if g.Image != "" {
+		pairs = append(pairs, "image="+g.Image)
+	}
+	pairs = append(pairs, "scale="+strconv.Itoa(g.Scale))
+	for _, b := range []struct {
+		key   string
+		value *bool
+	}{{"render", g.Render}, {"lockfps", g.LockFPS}, {"sound", g.Sound}} {
+		if b.value != nil {
+			pairs = append(pairs, b.key+"="+strconv.FormatBool(*b.value))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// apply sets the engine flags of the group.
+func (g EnvGroup) apply(args *AppArgs) {
+	if g.Render != nil {
+		args.Render = *g.Render
+	}
+	if g.LockFPS != nil {
+		args.LockFPS = *g.LockFPS
+	}
+	if g.Sound != nil {
+		args.Sound = *g.Sound
+	}
+}
+
+// EnvGroups are the groups of envs to start, in order. It implements
+// pflag.SliceValue so it can be used as repeatable flag directly. Groups can
+// be separated by semicolons too.
+type EnvGroups []EnvGroup
+
+func (g *EnvGroups) String() string {
+	groups := make([]string, len(*g))
+	for i, group := range *g {
+		groups[i] = group.String()
+	}
+	return "[" + strings.Join(groups, ";") + "]"
+}
+
+func (g *EnvGroups) Set(s string) error {
+	for _, part := range strings.Split(s, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		if err := g.Append(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *EnvGroups) Type() string {
+	return "group"
+}
+
+func (g *EnvGroups) Append(s string) error {
+	group, err := ParseEnvGroup(s)
+	if err != nil {
+		return err
+	}
+	*g = append(*g, group)
+	return nil
+}
+
+func (g *EnvGroups) Replace(ss []string) error {
+	groups := EnvGroups{}
+	for _, s := range ss {
+		if err := groups.Append(s); err != nil {
+			return err
+		}
+	}
+	*g = groups
+	return nil
+}
+
+func (g *EnvGroups) GetSlice() []string {
+	groups := make([]string, len(*g))
+	for i, group := range *g {
+		groups[i] = group.String()
+	}
+	return groups
+}
+
+// validateGroups defaults the name and image of the groups and sets the
+// scale to the number of envs of all groups. Setting the scale otherwise is an
+// error.
+func (c *EnvConfig) validateGroups() error {
+	if len(c.Groups) == 0 {
+		return nil
+	}
+	// Names are compared like their variables, see groupEnvVar.
+	names := map[string]string{}
+	scale := 0
+	for i := range c.Groups {
+		g := &c.Groups[i]
+		if g.Name == "" {
+			g.Name = strconv.Itoa(i)
+		}
+		if name, ok := names[groupEnvVar(g.Name)]; ok {
+			return fmt.Errorf("duplicate env group %s, names are case insensitive and %s is taken already", g.Name, name)
+		}
+		names[groupEnvVar(g.Name)] = g.Name
+		if g.Image == "" {
+			g.Image = c.Image
+		}
+		scale += g.Scale
+	}
+	// The default scale of 1 can't be told apart from an explicit one.
+	if c.Scale != 1 && c.Scale != scale {
+		return fmt.Errorf("--env.scale %d can't be combined with --env.group, set the scale of the groups instead", c.Scale)
+	}
+	c.Scale = scale
+	return nil
+}
+
+// group returns the group of env envID, nil without groups.
+func (c *EnvConfig) group(envID int) *EnvGroup {
+	for i := range c.Groups {
+		if envID < c.Groups[i].Scale {
+			return &c.Groups[i]
+		}
+		envID -= c.Groups[i].Scale
+	}
+	return nil
+}
+
+// images returns the images of the envs, each once.
+func (c *EnvConfig) images() []string {
+	if len(c.Groups) == 0 {
+		return []string{c.Image}
+	}
+	images := []string{}
+	seen := map[string]bool{}
+	for _, g := range c.Groups {
+		if !seen[g.Image] {
+			seen[g.Image] = true
+			images = append(images, g.Image)
+		}
+	}
+	return images
+}
+
+// groupEnvVar returns the variable listing the endpoints of the group name.
+func groupEnvVar(name string) string {
+	return "DIAMBRA_ENVS_" + strings.ToUpper(name)
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diambra
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnvGroup(t *testing.T) {
+	yes, no := true, false
+	for _, tc := range []struct {
+		name     string
+		value    string
+		expected EnvGroup
+		err      string
+	}{
+		{"defaults", "image=a", EnvGroup{Image: "a", Scale: 1}, ""},
+		{"full", "name=eval,image=a:v2.2,scale=3,render=true,lockfps=false,sound=1", EnvGroup{Name: "eval", Image: "a:v2.2", Scale: 3, Render: &yes, LockFPS: &no, Sound: &yes}, ""},
+		{"invalid pair", "image", EnvGroup{}, "invalid env group image, expected key=value pairs"},
+		{"invalid scale", "scale=0", EnvGroup{}, "invalid scale 0 of env group scale=0, must be at least 1"},
+		{"invalid bool", "render=maybe", EnvGroup{}, "invalid render of env group render=maybe"},
+		{"invalid name", "name=a-b", EnvGroup{}, "invalid env group name a-b"},
+		{"unknown key", "color=red", EnvGroup{}, "unknown key color in env group color=red"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := ParseEnvGroup(tc.value)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, g)
+			// Groups can be parsed from their string representation.
+			parsed, err := ParseEnvGroup(g.String())
+			require.NoError(t, err)
+			assert.Equal(t, g, parsed)
+		})
+	}
+}
+
+func TestEnvGroups(t *testing.T) {
+	groups := EnvGroups{}
+	require.NoError(t, groups.Set("image=a,scale=2"))
+	require.NoError(t, groups.Set("image=b;name=eval,render=true"))
+	assert.Equal(t, "[image=a,scale=2;image=b,scale=1;name=eval,scale=1,render=true]", groups.String())
+	assert.Error(t, groups.Set("scale=x"))
+
+	c := &EnvConfig{Image: "default", Scale: 1, Groups: groups}
+	require.NoError(t, c.validateGroups())
+	assert.Equal(t, 4, c.Scale)
+	assert.Equal(t, []string{"0", "1", "eval"}, []string{c.Groups[0].Name, c.Groups[1].Name, c.Groups[2].Name})
+	assert.Equal(t, "default", c.Groups[2].Image)
+	assert.Equal(t, []string{"a", "b", "default"}, c.images())
+	for envID, expected := range []string{"0", "0", "1", "eval"} {
+		assert.Equal(t, expected, c.group(envID).Name)
+	}
+	assert.Nil(t, c.group(4))
+
+	// Validating again keeps the scale.
+	require.NoError(t, c.validateGroups())
+	assert.Equal(t, 4, c.Scale)
+}
+
+func TestEnvGroupsInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		groups []string
+		scale  int
+		err    string
+	}{
+		{"duplicate", []string{"name=a", "name=a"}, 1, "duplicate env group a, names are case insensitive and a is taken already"},
+		{"duplicate case", []string{"name=eval", "name=EVAL"}, 1, "duplicate env group EVAL, names are case insensitive and eval is taken already"},
+		{"duplicate index", []string{"name=1", "image=b"}, 1, "duplicate env group 1"},
+		{"scale", []string{"scale=2"}, 3, "--env.scale 3 can't be combined with --env.group, set the scale of the groups instead"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			groups := EnvGroups{}
+			require.NoError(t, groups.Replace(tc.groups))
+			c := &EnvConfig{Scale: tc.scale, Groups: groups}
+			assert.ErrorContains(t, c.validateGroups(), tc.err)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diambra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/diambra/cli/pkg/container"
+	"github.com/go-kit/log/level"
+)
+
+// PullPolicy decides when images get pulled before starting a container.
+type PullPolicy string
+
+const (
+	PullAlways  PullPolicy = "always"
+	PullMissing PullPolicy = "missing"
+	PullNever   PullPolicy = "never"
+)
+
+func (p *PullPolicy) String() string {
+	return string(*p)
+}
+
+func (p *PullPolicy) Set(s string) error {
+	switch PullPolicy(s) {
+	case PullAlways, PullMissing, PullNever:
+		*p = PullPolicy(s)
+		return nil
+	}
+	return fmt.Errorf("invalid pull policy %s, must be one of %s, %s, %s", s, PullAlways, PullMissing, PullNever)
+}
+
+func (p *PullPolicy) Type() string {
+	return "policy"
+}
+
+// pull makes sure the image of the container is available according to the
+// pull policy. Every image gets pulled at most once per session.
+func (d *Diambra) pull(ctx context.Context, c *container.Container) error {
+	d.pulledMu.Lock()
+	defer d.pulledMu.Unlock()
+	if d.pulled[c.Image] {
+		return nil
+	}
+
+	policy := d.config.pullPolicy()
+	if policy != PullAlways {
+		exists, err := d.Runner.ImageExists(ctx, c.Image)
+		if err != nil {
+			return fmt.Errorf("couldn't check for image %s: %w", c.Image, err)
+		}
+		switch {
+		case exists:
+			level.Debug(d.Logger).Log("msg", "using local image", "image", c.Image)
+			d.pulled[c.Image] = true
+			return nil
+		case policy == PullNever:
+			return fmt.Errorf("image %s not found locally and pulling is disabled by --images.pull=%s", c.Image, policy)
+		}
+	}
+
+	ctx, cancel := withTimeout(ctx, d.config.Timeouts.Pull)
+	defer cancel()
+	if err := d.Runner.Pull(ctx, c, d.config.Output); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("couldn't pull image %s within %s (--timeout.pull): %w", c.Image, d.config.Timeouts.Pull, err)
+		}
+		return err
+	}
+	d.pulled[c.Image] = true
+	return nil
+}
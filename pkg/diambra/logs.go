@@ -0,0 +1,50 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diambra
+
+import (
+	"io"
+	"path/filepath"
+
+	clilog "github.com/diambra/cli/pkg/log"
+	"github.com/go-kit/log/level"
+)
+
+// LogFilePath returns the path of the log file for the container with the given name.
+func (l LogFiles) LogFilePath(session, name string) string {
+	return filepath.Join(l.Dir, session, name+".log")
+}
+
+// logFile opens the log file for the container with the given name. It
+// returns nil if log files are disabled or the file can't be opened, in which
+// case the output is only logged.
+func (d *Diambra) logFile(name string) io.WriteCloser {
+	if d.config.LogFiles.Dir == "" {
+		return nil
+	}
+	path := d.config.LogFiles.LogFilePath(d.session, name)
+	maxSize, err := d.config.LogFiles.maxSize()
+	if err == nil {
+		var f *clilog.RotatingFile
+		f, err = clilog.NewRotatingFile(path, maxSize, d.config.LogFiles.MaxFiles)
+		if err == nil {
+			level.Debug(d.Logger).Log("msg", "writing container output to file", "name", name, "path", path)
+			return f
+		}
+	}
+	level.Warn(d.Logger).Log("msg", "couldn't open log file", "path", path, "err", err.Error())
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diambra
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// PortRange is a range of host ports to publish the envs on. It implements
+// pflag.Value so it can be used as flag directly.
+type PortRange struct {
+	First int
+	Last  int
+}
+
+func (r *PortRange) String() string {
+	switch {
+	case r.First == 0:
+		return ""
+	case r.First == r.Last:
+		return strconv.Itoa(r.First)
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+func (r *PortRange) Set(s string) error {
+	if s == "" {
+		*r = PortRange{}
+		return nil
+	}
+	first, last, found := strings.Cut(s, "-")
+	if !found {
+		last = first
+	}
+	var (
+		pr  PortRange
+		err error
+	)
+	if pr.First, err = strconv.Atoi(first); err != nil {
+		return fmt.Errorf("invalid port range %s: %w", s, err)
+	}
+	if pr.Last, err = strconv.Atoi(last); err != nil {
+		return fmt.Errorf("invalid port range %s: %w", s, err)
+	}
+	if pr.First < 1 || pr.Last > 65535 || pr.First > pr.Last {
+		return fmt.Errorf("invalid port range %s, must be first-last within 1-65535", s)
+	}
+	*r = pr
+	return nil
+}
+
+func (r *PortRange) Type() string {
+	return "range"
+}
+
+// Len returns the number of ports in the range.
+func (r PortRange) Len() int {
+	if r.First == 0 {
+		return 0
+	}
+	return r.Last - r.First + 1
+}
+
+// allocatePort returns the first port of the range that wasn't handed out
+// yet and is free on host. Ports found in use are skipped for good.
+func (d *Diambra) allocatePort() (int, error) {
+	d.portsMu.Lock()
+	defer d.portsMu.Unlock()
+	r := d.config.Ports
+	for port := r.First; port <= r.Last; port++ {
+		if d.ports[port] {
+			continue
+		}
+		d.ports[port] = true
+		if portFree(d.config.Host, port) {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free port left in --env.ports %s", r.String())
+}
+
+// portFree checks if port can be listened on at host. The probe socket gets
+// closed right away, so the port is free for the container to use.
+func portFree(host string, port int) bool {
+	lis, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	lis.Close()
+	return true
+}
+
+// isPortConflict returns whether a container couldn't be started because its
+// host port got taken in the meantime.
+func isPortConflict(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "port is already allocated") || strings.Contains(msg, "address already in use")
+}
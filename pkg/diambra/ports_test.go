@@ -0,0 +1,139 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diambra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/diambra/cli/pkg/container/containertest"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortRange(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want PortRange
+		str  string
+		err  bool
+	}{
+		{in: "50051-50150", want: PortRange{50051, 50150}, str: "50051-50150"},
+		{in: "50051", want: PortRange{50051, 50051}, str: "50051"},
+		{in: "", want: PortRange{}, str: ""},
+		{in: "50150-50051", err: true},
+		{in: "0-10", err: true},
+		{in: "1-65536", err: true},
+		{in: "a-b", err: true},
+		{in: "1-", err: true},
+	} {
+		t.Run(tc.in, func(t *testing.T) {
+			var r PortRange
+			err := r.Set(tc.in)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, r)
+			assert.Equal(t, tc.str, r.String())
+		})
+	}
+}
+
+// freePortRange returns a range of n ports that are free on 127.0.0.1.
+func freePortRange(t *testing.T, n int) PortRange {
+	for base := 42000; base < 60000; base += n {
+		free := true
+		for port := base; port < base+n; port++ {
+			if !portFree("127.0.0.1", port) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return PortRange{base, base + n - 1}
+		}
+	}
+	t.Fatalf("no %d free ports found", n)
+	return PortRange{}
+}
+
+func TestDiambraPorts(t *testing.T) {
+	config := newTestConfig(t)
+	config.Scale = 2
+	config.Ports = freePortRange(t, 4)
+	base := config.Ports.First
+
+	// The first port is in use by something else, so the envs get the next
+	// ones. The port of env 0 gets taken between checking and starting the
+	// container, so it moves on to the last one.
+	busy, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", base))
+	require.NoError(t, err)
+	defer busy.Close()
+	runner := containertest.NewRunner()
+	runner.FailAt(containertest.StepStart, 1, errors.New("Bind for 127.0.0.1:1 failed: port is already allocated"))
+
+	d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+	require.NoError(t, d.Start(context.Background()))
+	defer d.Cleanup(context.Background())
+
+	envs, err := d.EnvsString()
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("127.0.0.1:%d 127.0.0.1:%d", base+3, base+2), envs)
+	assert.Equal(t, 3, runner.Calls(containertest.StepStart))
+}
+
+func TestDiambraPortsExhausted(t *testing.T) {
+	config := newTestConfig(t)
+	config.Scale = 2
+	config.Ports = freePortRange(t, 2)
+
+	busy, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", config.Ports.Last))
+	require.NoError(t, err)
+	defer busy.Close()
+	runner := containertest.NewRunner()
+
+	d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+	err = d.Start(context.Background())
+	assert.EqualError(t, err, fmt.Sprintf("no free port left in --env.ports %s", config.Ports.String()))
+	assert.NoError(t, d.Cleanup(context.Background()))
+}
+
+func TestDiambraPortsTooFew(t *testing.T) {
+	config := newTestConfig(t)
+	config.Scale = 3
+	config.Ports = PortRange{50051, 50052}
+	assert.EqualError(t, config.Validate(), "--env.ports 50051-50052 has 2 ports, not enough for 3 envs")
+}
+
+func TestPreallocatePortReleased(t *testing.T) {
+	config := newTestConfig(t)
+	config.PreallocatePort = true
+	c, err := newEnvContainer(config, 0, 0)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(string((*c.PortMapping)[ContainerPort].Port))
+	require.NoError(t, err)
+	assert.NotZero(t, port)
+	assert.True(t, portFree("", port))
+}
@@ -0,0 +1,305 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diambra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diambra/cli/pkg/container"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// SessionState is the record of a running session, so other commands can find
+// and use its envs.
+type SessionState struct {
+	Session   string             `json:"session"`
+	CreatedAt time.Time          `json:"created_at"`
+	Image     string             `json:"image"`
+	Network   string             `json:"network"`
+	Envs      []EnvState         `json:"envs"`
+	Config    SessionStateConfig `json:"config"`
+}
+
+type EnvState struct {
+	Index            int    `json:"index"`
+	ID               string `json:"id"`
+	Address          string `json:"address"`           // host:port to connect to from this host
+	ContainerAddress string `json:"container_address"` // alias:port on the session network
+	Seed             int    `json:"seed"`
+	Group            string `json:"group,omitempty"`
+}
+
+// SessionStateConfig is the configuration the envs of a session got started with.
+type SessionStateConfig struct {
+	Scale      int               `json:"scale"`
+	Host       string            `json:"host"`
+	Ports      string            `json:"ports,omitempty"`
+	Render     bool              `json:"render"`
+	LockFPS    bool              `json:"lock_fps"`
+	Sound      bool              `json:"sound"`
+	EngineArgs map[string]string `json:"engine_args,omitempty"`
+	Seed       int               `json:"seed,omitempty"` // base of the env seeds, 0 for random seeds
+	Groups     []string          `json:"groups,omitempty"`
+	AutoRemove bool              `json:"auto_remove"`
+	Restart    string            `json:"restart,omitempty"`
+	Memory     string            `json:"memory,omitempty"`
+	CPUs       float64           `json:"cpus,omitempty"`
+}
+
+// SessionsDir returns the directory the session states are kept in.
+func SessionsDir(home string) string {
+	return filepath.Join(home, ".diambra", "sessions")
+}
+
+func sessionStatePath(dir, session string) string {
+	return filepath.Join(dir, session+".json")
+}
+
+// LoadSessionState reads the state of the given session. It returns an error
+// wrapping os.ErrNotExist if there's none.
+func LoadSessionState(dir, session string) (*SessionState, error) {
+	b, err := os.ReadFile(sessionStatePath(dir, session))
+	if err != nil {
+		return nil, err
+	}
+	s := &SessionState{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("invalid state of session %s: %w", session, err)
+	}
+	return s, nil
+}
+
+// ListSessionStates returns the states of all sessions, ordered by name.
+func ListSessionStates(dir string) ([]*SessionState, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	states := []*SessionState{}
+	for _, e := range entries {
+		session, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok || strings.HasPrefix(session, ".") {
+			continue
+		}
+		s, err := LoadSessionState(dir, session)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, s)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Session < states[j].Session })
+	return states, nil
+}
+
+// RemoveSessionState removes the state of the given session, if any.
+func RemoveSessionState(dir, session string) error {
+	if err := os.Remove(sessionStatePath(dir, session)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Write writes the state to dir, replacing the previous state of the session.
+func (s *SessionState) Write(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so readers never see a partial state.
+	tmp, err := os.CreateTemp(dir, "."+s.Session+"-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), sessionStatePath(dir, s.Session))
+}
+
+// PruneSessionStates removes the states of sessions without running containers.
+func PruneSessionStates(ctx context.Context, logger log.Logger, runner container.Runner, dir string) error {
+	states, err := ListSessionStates(dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range states {
+		infos, err := runner.List(ctx, s.Session)
+		if err != nil {
+			return err
+		}
+		running := false
+		for _, info := range infos {
+			if info.State == "running" {
+				running = true
+				break
+			}
+		}
+		if running {
+			continue
+		}
+		level.Info(logger).Log("msg", "removing record of stopped session", "session", s.Session)
+		if err := RemoveSessionState(dir, s.Session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// State returns the current state of the session. If the session got recorded
+// already, it keeps the creation time of the record.
+func (d *Diambra) State() (*SessionState, error) {
+	s, err := d.state()
+	if err != nil {
+		return nil, err
+	}
+	if d.config.SessionsDir != "" {
+		if prev, err := LoadSessionState(d.config.SessionsDir, d.session); err == nil {
+			s.CreatedAt = prev.CreatedAt
+		}
+	}
+	return s, nil
+}
+
+func (d *Diambra) state() (*SessionState, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	portn, err := container.Port(ContainerPort).Number()
+	if err != nil {
+		return nil, err
+	}
+	s := &SessionState{
+		Session:   d.session,
+		CreatedAt: time.Now().UTC(),
+		Image:     d.config.Image,
+		Network:   d.network,
+		Envs:      make([]EnvState, len(d.Envs)),
+		Config: SessionStateConfig{
+			Scale:      d.config.Scale,
+			Host:       d.config.Host,
+			Ports:      d.config.Ports.String(),
+			Render:     d.config.AppArgs.Render,
+			LockFPS:    d.config.AppArgs.LockFPS,
+			Sound:      d.config.AppArgs.Sound,
+			EngineArgs: d.config.AppArgs.Extra,
+			Seed:       d.config.Seed,
+			Groups:     d.config.Groups.GetSlice(),
+			AutoRemove: d.config.AutoRemove,
+			Restart:    string(d.config.Restart),
+			Memory:     d.config.EnvResources.Memory,
+			CPUs:       d.config.EnvResources.CPUs,
+		},
+	}
+	for i, env := range d.Envs {
+		addr, err := HostAddress(env.Address)
+		if err != nil {
+			return nil, err
+		}
+		s.Envs[i] = EnvState{
+			Index:            env.Index,
+			ID:               env.ID,
+			Address:          addr,
+			ContainerAddress: fmt.Sprintf("%s:%d", envAlias(env.Index), portn),
+			Seed:             env.Seed,
+			Group:            env.Group,
+		}
+	}
+	return s, nil
+}
+
+// saveState records the session, keeping the creation time of an existing record.
+func (d *Diambra) saveState() {
+	dir := d.config.SessionsDir
+	if dir == "" {
+		return
+	}
+	s, err := d.State()
+	if err == nil {
+		err = s.Write(dir)
+	}
+	if err != nil {
+		level.Warn(d.Logger).Log("msg", "couldn't record session", "session", d.session, "err", err.Error())
+	}
+}
+
+// removeState removes the record of the session.
+func (d *Diambra) removeState() {
+	if d.config.SessionsDir == "" {
+		return
+	}
+	if err := RemoveSessionState(d.config.SessionsDir, d.session); err != nil {
+		level.Warn(d.Logger).Log("msg", "couldn't remove record of session", "session", d.session, "err", err.Error())
+	}
+}
+
+// attach uses the envs of the recorded session given by --attach-session.
+// Every env of the record needs to be running.
+func (d *Diambra) attach(ctx context.Context) error {
+	s, err := LoadSessionState(d.config.SessionsDir, d.session)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("session %s not found, start it with arena up --session %s", d.session, d.session)
+		}
+		return err
+	}
+	infos, err := d.Runner.List(ctx, d.session)
+	if err != nil {
+		return fmt.Errorf("couldn't list containers of session %s: %w", d.session, err)
+	}
+	running := map[int]*container.ContainerInfo{}
+	for _, info := range infos {
+		index, err := strconv.Atoi(info.Labels[container.LabelEnv])
+		if err != nil || info.State != "running" {
+			continue
+		}
+		running[index] = info
+	}
+	for _, es := range s.Envs {
+		info, ok := running[es.Index]
+		if !ok {
+			return fmt.Errorf("env %d of session %s isn't running anymore", es.Index, d.session)
+		}
+		addr, ok := (*info.PortMapping)[ContainerPort]
+		if !ok {
+			return fmt.Errorf("env %d of session %s doesn't publish port %s", es.Index, d.session, ContainerPort)
+		}
+		status := info.ContainerStatus
+		d.Envs = append(d.Envs, &Env{ContainerStatus: &status, Address: addr, Index: es.Index, Seed: es.Seed, Group: es.Group})
+	}
+	d.reused = true
+	level.Info(d.Logger).Log("msg", "attached to session", "session", d.session, "envs", len(d.Envs))
+	return nil
+}
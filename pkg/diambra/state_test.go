@@ -0,0 +1,127 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diambra
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/diambra/cli/pkg/container/containertest"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiambraSessionState(t *testing.T) {
+	config := newTestConfig(t)
+	config.Scale = 2
+	runner := containertest.NewRunner()
+	d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+	require.NoError(t, d.Start(context.Background()))
+
+	s, err := LoadSessionState(config.SessionsDir, d.Session())
+	require.NoError(t, err)
+	assert.Equal(t, d.Session(), s.Session)
+	assert.Equal(t, "diambra/engine:test", s.Image)
+	assert.Equal(t, "diambra-"+d.Session(), s.Network)
+	assert.Equal(t, 2, s.Config.Scale)
+	require.Len(t, s.Envs, 2)
+	for i, es := range s.Envs {
+		ct := runner.Containers()[i]
+		assert.Equal(t, EnvState{
+			Index:            i,
+			ID:               ct.ID,
+			Address:          ct.Endpoint(ContainerPort),
+			ContainerAddress: envAlias(i) + ":50051",
+			Seed:             d.Envs[i].Seed,
+		}, es)
+	}
+
+	states, err := ListSessionStates(config.SessionsDir)
+	require.NoError(t, err)
+	assert.Len(t, states, 1)
+
+	require.NoError(t, d.Cleanup(context.Background()))
+	_, err = LoadSessionState(config.SessionsDir, d.Session())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDiambraAttachSession(t *testing.T) {
+	config := newTestConfig(t)
+	config.Scale = 2
+	config.Session = "foo"
+	runner := containertest.NewRunner()
+	owner, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+	require.NoError(t, owner.Start(context.Background()))
+	envs, err := owner.EnvsString()
+	require.NoError(t, err)
+
+	attachConfig := newTestConfig(t)
+	attachConfig.SessionsDir = config.SessionsDir
+	attachConfig.AttachSession = "foo"
+	d, err := NewDiambra(log.NewNopLogger(), nil, runner, attachConfig)
+	require.NoError(t, err)
+	require.NoError(t, d.Start(context.Background()))
+	attached, err := d.EnvsString()
+	require.NoError(t, err)
+	assert.Equal(t, envs, attached)
+	for i, env := range d.Envs {
+		assert.Equal(t, owner.Envs[i].Seed, env.Seed)
+	}
+	assert.Len(t, runner.Containers(), 2)
+
+	// Attached envs are left running.
+	require.NoError(t, d.Cleanup(context.Background()))
+	assert.Len(t, runner.Running(), 2)
+	_, err = LoadSessionState(config.SessionsDir, "foo")
+	assert.NoError(t, err)
+
+	// Sessions need to be recorded and fully running.
+	attachConfig.AttachSession = "bar"
+	d, err = NewDiambra(log.NewNopLogger(), nil, runner, attachConfig)
+	require.NoError(t, err)
+	assert.EqualError(t, d.Start(context.Background()), "session bar not found, start it with arena up --session bar")
+
+	runner.Containers()[1].Exit(1)
+	attachConfig.AttachSession = "foo"
+	d, err = NewDiambra(log.NewNopLogger(), nil, runner, attachConfig)
+	require.NoError(t, err)
+	assert.EqualError(t, d.Start(context.Background()), "env 1 of session foo isn't running anymore")
+	assert.Len(t, runner.Containers(), 2)
+}
+
+func TestPruneSessionStates(t *testing.T) {
+	dir := t.TempDir()
+	runner := containertest.NewRunner()
+	for _, session := range []string{"running", "stopped"} {
+		config := newTestConfig(t)
+		config.SessionsDir = dir
+		config.Session = session
+		d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+		require.NoError(t, err)
+		require.NoError(t, d.Start(context.Background()))
+	}
+	require.NoError(t, runner.StopAll(context.Background(), "stopped"))
+
+	require.NoError(t, PruneSessionStates(context.Background(), log.NewNopLogger(), runner, dir))
+	states, err := ListSessionStates(dir)
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	assert.Equal(t, "running", states[0].Session)
+}
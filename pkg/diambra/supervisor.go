@@ -0,0 +1,169 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diambra
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/diambra/cli/pkg/container"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// RestartPolicy decides whether exited env containers get restarted.
+type RestartPolicy string
+
+const (
+	RestartNo        RestartPolicy = "no"
+	RestartOnFailure RestartPolicy = "on-failure"
+	RestartAlways    RestartPolicy = "always"
+)
+
+func (p *RestartPolicy) String() string {
+	return string(*p)
+}
+
+func (p *RestartPolicy) Set(s string) error {
+	switch RestartPolicy(s) {
+	case RestartNo, RestartOnFailure, RestartAlways:
+		*p = RestartPolicy(s)
+		return nil
+	}
+	return fmt.Errorf("invalid restart policy %s, must be one of %s, %s, %s", s, RestartNo, RestartOnFailure, RestartAlways)
+}
+
+func (p *RestartPolicy) Type() string {
+	return "policy"
+}
+
+// restart returns whether a container that exited with the given status should be restarted.
+func (p RestartPolicy) restart(status int) bool {
+	switch p {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return status != 0
+	}
+	return false
+}
+
+var (
+	restartBackoff    = time.Second
+	restartBackoffMax = 30 * time.Second
+)
+
+// exitReason describes why a container exited with the given status.
+func exitReason(status int) string {
+	switch {
+	case status == container.ExitCodeKilled:
+		return fmt.Sprintf("killed (exit status %d), possibly out of memory", status)
+	case status > 128:
+		return fmt.Sprintf("terminated by signal: %s (exit status %d)", syscall.Signal(status-128), status)
+	}
+	return fmt.Sprintf("exit status %d", status)
+}
+
+// supervise watches the env container and restarts it according to the
+// restart policy until ctx gets canceled.
+func (d *Diambra) supervise(ctx context.Context, envID int, env *Env, c *container.Container) {
+	defer d.supervisors.Done()
+	logger := log.With(d.Logger, "envID", envID)
+	restarts := 0
+	for {
+		d.mu.Lock()
+		id := env.ContainerStatus.ID
+		d.mu.Unlock()
+
+		status, err := d.Runner.Wait(ctx, id)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			level.Error(logger).Log("msg", "couldn't watch env container, not restarting it anymore", "id", id, "err", err.Error())
+			return
+		}
+		reason := exitReason(status)
+		if !d.config.Restart.restart(status) {
+			level.Warn(logger).Log("msg", "env container exited", "id", id, "reason", reason)
+			return
+		}
+
+		backoff := restartBackoff
+		for attempt := 1; ; attempt++ {
+			level.Warn(logger).Log("msg", "env container exited, restarting", "id", id, "reason", reason, "restarts", restarts, "attempt", attempt)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if err := d.restart(ctx, envID, env, c, restarts+1); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				reason = err.Error()
+				if backoff *= 2; backoff > restartBackoffMax {
+					backoff = restartBackoffMax
+				}
+				continue
+			}
+			restarts++
+			level.Info(logger).Log("msg", "env restarted", "id", env.ContainerStatus.ID, "restarts", restarts)
+			d.saveState()
+			break
+		}
+	}
+}
+
+// restart replaces the env container by a new one published on the same host
+// port, labeled with the number of restarts including this one.
+func (d *Diambra) restart(ctx context.Context, envID int, env *Env, c *container.Container, restarts int) error {
+	d.mu.Lock()
+	id := env.ContainerStatus.ID
+	d.mu.Unlock()
+	if err := d.Runner.Remove(ctx, id); err != nil {
+		return fmt.Errorf("couldn't remove exited container: %w", err)
+	}
+
+	rc := *c
+	pm := container.PortMapping{}
+	pm.AddPortMapping(ContainerPort, string(env.Address.Port), env.Address.Host)
+	rc.PortMapping = &pm
+	rc.Labels = make(map[string]string, len(c.Labels)+1)
+	for k, v := range c.Labels {
+		rc.Labels[k] = v
+	}
+	rc.Labels[container.LabelRestarts] = strconv.Itoa(restarts)
+
+	startCtx, cancel := withTimeout(ctx, d.config.Timeouts.Start)
+	defer cancel()
+	cs, err := d.Runner.Start(startCtx, &rc)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	env.ContainerStatus = cs
+	d.mu.Unlock()
+
+	tail := d.followLogs(ctx, envID, cs.ID, time.Time{}, d.logFile(envAlias(envID)))
+	if err := d.waitReady(startCtx, envID, env, tail); err != nil {
+		return d.readyError(ctx, startCtx, envID, err)
+	}
+	return nil
+}
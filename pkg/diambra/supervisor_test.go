@@ -0,0 +1,109 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diambra
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diambra/cli/pkg/container"
+	"github.com/diambra/cli/pkg/container/containertest"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisor(t *testing.T) {
+	restartBackoff = time.Millisecond
+	for _, tc := range []struct {
+		policy   RestartPolicy
+		status   int
+		restarts bool
+	}{
+		{RestartNo, 1, false},
+		{RestartOnFailure, 1, true},
+		{RestartOnFailure, 0, false},
+		{RestartAlways, 0, true},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			config := newTestConfig(t)
+			config.Scale = 2
+			config.Restart = tc.policy
+			runner := containertest.NewRunner()
+			d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+			require.NoError(t, err)
+			require.NoError(t, d.Start(context.Background()))
+			envs, err := d.EnvsString()
+			require.NoError(t, err)
+
+			crashed := runner.Containers()[0]
+			crashed.Exit(tc.status)
+			if !tc.restarts {
+				time.Sleep(50 * time.Millisecond)
+				assert.Len(t, runner.Containers(), 2)
+				assert.NoError(t, d.Cleanup(context.Background()))
+				return
+			}
+
+			require.Eventually(t, func() bool {
+				return len(runner.Running()) == 2
+			}, 5*time.Second, 10*time.Millisecond)
+			ct := runner.Containers()
+			require.Len(t, ct, 3)
+			assert.Equal(t, crashed.Name, ct[2].Name)
+			assert.Equal(t, "1", ct[2].Labels[container.LabelRestarts])
+			assert.Empty(t, crashed.Labels[container.LabelRestarts])
+			// The restarted env is reachable at the same address.
+			assert.Equal(t, crashed.Endpoint(ContainerPort), ct[2].Endpoint(ContainerPort))
+			restartedEnvs, err := d.EnvsString()
+			assert.NoError(t, err)
+			assert.Equal(t, envs, restartedEnvs)
+
+			assert.NoError(t, d.Cleanup(context.Background()))
+			assert.Empty(t, runner.Running())
+		})
+	}
+}
+
+func TestSupervisorRestartFailure(t *testing.T) {
+	restartBackoff = time.Millisecond
+	config := newTestConfig(t)
+	config.Restart = RestartAlways
+	runner := containertest.NewRunner()
+	// The first attempt to restart the env fails.
+	runner.FailAt(containertest.StepStart, 2, errors.New("scripted failure"))
+	d, err := NewDiambra(log.NewNopLogger(), nil, runner, config)
+	require.NoError(t, err)
+	require.NoError(t, d.Start(context.Background()))
+	defer d.Cleanup(context.Background())
+
+	runner.Containers()[0].Exit(1)
+	require.Eventually(t, func() bool {
+		return len(runner.Running()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	ct := runner.Containers()
+	require.Len(t, ct, 2)
+	// Only successful restarts count.
+	assert.Equal(t, "1", ct[1].Labels[container.LabelRestarts])
+}
+
+func TestExitReason(t *testing.T) {
+	assert.Equal(t, "exit status 1", exitReason(1))
+	assert.Equal(t, "killed (exit status 137), possibly out of memory", exitReason(137))
+	assert.Contains(t, exitReason(139), "exit status 139")
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2025 The DIAMBRA Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		maxSize  int64
+		maxFiles int
+		writes   []string
+		want     map[string]string
+	}{
+		{
+			name:     "no rotation",
+			maxSize:  0,
+			maxFiles: 2,
+			writes:   []string{"aaaa\n", "bbbb\n", "cccc\n"},
+			want:     map[string]string{"env.log": "aaaa\nbbbb\ncccc\n"},
+		},
+		{
+			name:     "fits",
+			maxSize:  10,
+			maxFiles: 2,
+			writes:   []string{"aaaa\n", "bbbb\n"},
+			want:     map[string]string{"env.log": "aaaa\nbbbb\n"},
+		},
+		{
+			name:     "rotates",
+			maxSize:  10,
+			maxFiles: 2,
+			writes:   []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"},
+			want: map[string]string{
+				"env.log":   "gggg\n",
+				"env.log.1": "eeee\nffff\n",
+				"env.log.2": "cccc\ndddd\n",
+			},
+		},
+		{
+			name:     "oversized write",
+			maxSize:  4,
+			maxFiles: 1,
+			writes:   []string{"aaaa\n", "bbbb\n"},
+			want: map[string]string{
+				"env.log":   "bbbb\n",
+				"env.log.1": "aaaa\n",
+			},
+		},
+		{
+			name:     "no rotated files",
+			maxSize:  5,
+			maxFiles: 0,
+			writes:   []string{"aaaa\n", "bbbb\n"},
+			want:     map[string]string{"env.log": "bbbb\n"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			f, err := NewRotatingFile(filepath.Join(dir, "sub", "env.log"), tc.maxSize, tc.maxFiles)
+			require.NoError(t, err)
+			for _, w := range tc.writes {
+				n, err := f.Write([]byte(w))
+				require.NoError(t, err)
+				assert.Equal(t, len(w), n)
+			}
+			require.NoError(t, f.Close())
+
+			entries, err := os.ReadDir(filepath.Join(dir, "sub"))
+			require.NoError(t, err)
+			got := map[string]string{}
+			for _, e := range entries {
+				b, err := os.ReadFile(filepath.Join(dir, "sub", e.Name()))
+				require.NoError(t, err)
+				got[e.Name()] = string(b)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0644))
+
+	f, err := NewRotatingFile(path, 6, 1)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("new\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "new\n", string(b))
+	b, err = os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "old\n", string(b))
+}